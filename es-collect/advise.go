@@ -0,0 +1,276 @@
+package es_collect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/olivere/elastic.v6"
+)
+
+//residency class of an index
+const (
+	INDEX_HOT  = "hot"
+	INDEX_WARM = "warm"
+	INDEX_COLD = "cold"
+)
+
+//extensions that index.store.preload is worth for, norms, doc values, terms, postings and points
+var PRELOAD_SUFFIXES = []string{"nvd", "dvd", "tim", "doc", "dim"}
+
+//cycles of every index read from the history, a week of collects every minute
+var HISTORY_MAX_CYCLES = 10080
+
+//cache of an index on this node in the history window, MB
+type CacheHistory struct {
+	MaxCache int
+	AvgCache float64
+	Cycles   int
+}
+
+type AdviseOptions struct {
+	//cached percent from which an index is hot, and up to which it is cold
+	HotPercent  float64
+	ColdPercent float64
+	//force-merge is suggested for warm and cold indices with more segments per shard
+	MaxSegmentsPerShard int
+	//version of the collected cluster, freeze is suggested only if it supports frozen indices
+	Version ClusterVersion
+}
+
+var DEFAULT_ADVISE_OPTIONS = AdviseOptions{HotPercent: 50, ColdPercent: 1, MaxSegmentsPerShard: 10}
+
+//one row of the advise report, cache and size are MB
+type Advice struct {
+	Rank            int      `json:"rank"`
+	IndexName       string   `json:"index_name"`
+	Class           string   `json:"class"`
+	CachedPercent   float64  `json:"cached_percent"`
+	Cache           int      `json:"cache"`
+	Size            int64    `json:"size"`
+	Segments        int      `json:"segments"`
+	Shards          int      `json:"shards"`
+	HistoryMaxCache int      `json:"history_max_cache"`
+	HistoryAvgCache float64  `json:"history_avg_cache"`
+	HistoryCycles   int      `json:"history_cycles"`
+	Actions         []string `json:"actions"`
+}
+
+type historyResponse struct {
+	Aggregations struct {
+		Indices struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				MaxCache struct {
+					Value float64 `json:"value"`
+				} `json:"max_cache"`
+				AvgCache struct {
+					Value float64 `json:"value"`
+				} `json:"avg_cache"`
+				Cycles struct {
+					Value int `json:"value"`
+				} `json:"cycles"`
+			} `json:"buckets"`
+		} `json:"indices"`
+	} `json:"aggregations"`
+}
+
+//cache of every index on nodeName in the window, from the docs written by the es output.
+//the primary and replica docs of one cycle are summed first, so the max and the average are of the cache per cycle.
+//the latest HISTORY_MAX_CYCLES cycles of every index are read
+func GetCacheHistory(esClient *elastic.Client, indexPrefix string, nodeName string, window time.Duration) (map[string]CacheHistory, error) {
+	filters := []interface{}{
+		map[string]interface{}{"range": map[string]interface{}{"created": map[string]interface{}{
+			"gte": time.Now().Add(-window).Format(time.RFC3339)}}},
+	}
+	if nodeName != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"node_name": nodeName}})
+	}
+	body := map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"aggs": map[string]interface{}{"indices": map[string]interface{}{
+			"terms": map[string]interface{}{"field": "index_name", "size": 10000},
+			"aggs": map[string]interface{}{
+				"cycle_cache": map[string]interface{}{
+					"terms": map[string]interface{}{"field": "created", "size": HISTORY_MAX_CYCLES, "order": map[string]string{"_key": "desc"}},
+					"aggs":  map[string]interface{}{"cache": map[string]interface{}{"sum": map[string]interface{}{"field": "cache.total"}}},
+				},
+				"max_cache": map[string]interface{}{"max_bucket": map[string]interface{}{"buckets_path": "cycle_cache>cache"}},
+				"avg_cache": map[string]interface{}{"avg_bucket": map[string]interface{}{"buckets_path": "cycle_cache>cache"}},
+				"cycles":    map[string]interface{}{"cardinality": map[string]interface{}{"field": "created"}},
+			},
+		}},
+	}
+	res, err := esClient.PerformRequest(context.TODO(), elastic.PerformRequestOptions{Method: "POST",
+		Path: "/" + indexPrefix + "*/_search", Body: body})
+	if err != nil {
+		return nil, fmt.Errorf("search cache history error, %v", err)
+	}
+	response := historyResponse{}
+	if err := json.Unmarshal(res.Body, &response); err != nil {
+		return nil, fmt.Errorf("parse cache history error, %v", err)
+	}
+	history := map[string]CacheHistory{}
+	for _, bucket := range response.Aggregations.Indices.Buckets {
+		history[bucket.Key] = CacheHistory{MaxCache: int(bucket.MaxCache.Value), AvgCache: bucket.AvgCache.Value, Cycles: bucket.Cycles.Value}
+	}
+	return history, nil
+}
+
+//classify every index by its residency now and in history, and suggest actions.
+//cold indices come first by size, then warm by size, then hot by cache
+func (indexStats IndexStats) Advise(history map[string]CacheHistory, options AdviseOptions) []Advice {
+	advices := make([]Advice, 0, len(indexStats.indexMap))
+	for _, index := range indexStats.indexMap {
+		//orphan directories are not an index to move or close
+		if index.indexName == ORPHAN_INDEX_NAME {
+			continue
+		}
+		advices = append(advices, adviseIndex(index, history, indexStats.node.Tier, options))
+	}
+	classOrder := map[string]int{INDEX_COLD: 0, INDEX_WARM: 1, INDEX_HOT: 2}
+	sort.Slice(advices, func(i, j int) bool {
+		left, right := advices[i], advices[j]
+		if left.Class != right.Class {
+			return classOrder[left.Class] < classOrder[right.Class]
+		}
+		if left.Class == INDEX_HOT && left.Cache != right.Cache {
+			return left.Cache > right.Cache
+		}
+		if left.Size != right.Size {
+			return left.Size > right.Size
+		}
+		return left.IndexName < right.IndexName
+	})
+	for i := range advices {
+		advices[i].Rank = i + 1
+	}
+	return advices
+}
+
+func adviseIndex(index Index, history map[string]CacheHistory, tier string, options AdviseOptions) Advice {
+	advice := Advice{IndexName: index.indexName, Cache: index.pageCache / FOUR_KB_TO_MB, Size: index.size / 1024 / 1024,
+		Segments: index.store().segments, Shards: index.shardCount, Actions: []string{}}
+	if index.pages > 0 {
+		advice.CachedPercent = float64(index.pageCache) / float64(index.pages) * 100
+	}
+	cacheHistory, hasHistory := history[index.indexName]
+	historyPercent := 0.0
+	if hasHistory {
+		advice.HistoryMaxCache = cacheHistory.MaxCache
+		advice.HistoryAvgCache = cacheHistory.AvgCache
+		advice.HistoryCycles = cacheHistory.Cycles
+		if advice.Size > 0 {
+			historyPercent = cacheHistory.AvgCache / float64(advice.Size) * 100
+		}
+	}
+
+	switch {
+	case advice.CachedPercent >= options.HotPercent || historyPercent >= options.HotPercent:
+		advice.Class = INDEX_HOT
+	case advice.CachedPercent <= options.ColdPercent && (!hasHistory || historyPercent <= options.ColdPercent):
+		advice.Class = INDEX_COLD
+	default:
+		advice.Class = INDEX_WARM
+	}
+
+	onHotTier := tier == "" || tier == "hot" || tier == "content"
+	switch advice.Class {
+	case INDEX_COLD:
+		if onHotTier {
+			advice.Actions = append(advice.Actions, "move to warm tier")
+		}
+		if options.Version.supportFreeze() {
+			advice.Actions = append(advice.Actions, "close or freeze")
+		} else {
+			advice.Actions = append(advice.Actions, "close")
+		}
+	case INDEX_WARM:
+		if onHotTier {
+			advice.Actions = append(advice.Actions, "move to warm tier")
+		}
+	case INDEX_HOT:
+		if advice.CachedPercent < 95 {
+			if suffixes := getPreloadSuffixes(index); len(suffixes) > 0 {
+				advice.Actions = append(advice.Actions, "enable index.store.preload for "+strings.Join(suffixes, ","))
+			}
+		}
+	}
+	if advice.Class != INDEX_HOT && advice.Shards > 0 && advice.Segments/advice.Shards > options.MaxSegmentsPerShard {
+		advice.Actions = append(advice.Actions, "force-merge")
+	}
+	return advice
+}
+
+//the two preloadable extensions with the most cache, they are what the index reads
+func getPreloadSuffixes(index Index) []string {
+	suffixes := make([]string, 0)
+	for _, suffix := range PRELOAD_SUFFIXES {
+		if fileSuffixCache, exist := index.fileSuffixStat[suffix]; exist && fileSuffixCache.pageCache > 0 {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	sort.SliceStable(suffixes, func(i, j int) bool {
+		return index.fileSuffixStat[suffixes[i]].pageCache > index.fileSuffixStat[suffixes[j]].pageCache
+	})
+	if len(suffixes) > 2 {
+		suffixes = suffixes[:2]
+	}
+	return suffixes
+}
+
+var adviceTitles = []string{"rank", "index_name", "class", "cached %", "cache (MB)", "size (MB)", "segments",
+	"history max (MB)", "history avg (MB)", "actions"}
+
+func FormatAdviceForConsole(advices []Advice) {
+	rows := make([][]string, 0, len(advices))
+	for _, advice := range advices {
+		rows = append(rows, []string{fmt.Sprintf("%d", advice.Rank), advice.IndexName, advice.Class,
+			fmt.Sprintf("%.2f", advice.CachedPercent), fmt.Sprintf("%d", advice.Cache), fmt.Sprintf("%d", advice.Size),
+			fmt.Sprintf("%d", advice.Segments), fmt.Sprintf("%d", advice.HistoryMaxCache),
+			fmt.Sprintf("%.1f", advice.HistoryAvgCache), strings.Join(advice.Actions, "; ")})
+	}
+	printTable(adviceTitles, rows)
+}
+
+func FormatAdviceForJson(advices []Advice) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(advices)
+}
+
+//print rows in the grid of the console output, every column is as wide as its longest cell
+func printTable(titles []string, rows [][]string) {
+	widths := make([]int, len(titles))
+	for i, title := range titles {
+		widths[i] = len(title)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	grid := "+"
+	line := "|"
+	for i, title := range titles {
+		grid += strings.Repeat("-", widths[i]+2) + "+"
+		line += fmt.Sprintf(" %-*s |", widths[i], title)
+	}
+	fmt.Println(line)
+	fmt.Println(grid)
+	for _, row := range rows {
+		line = "|"
+		for i, cell := range row {
+			line += fmt.Sprintf(" %-*s |", widths[i], cell)
+		}
+		fmt.Println(line)
+	}
+	fmt.Println(grid)
+}
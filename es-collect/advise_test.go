@@ -0,0 +1,118 @@
+package es_collect
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/olivere/elastic.v6"
+)
+
+//index of sizeMb on disk with cachedMb in cache, its segments spread over shards
+func newAdviseIndex(name string, sizeMb int, cachedMb int, segments int, shards int) Index {
+	return Index{indexName: name, pages: sizeMb * FOUR_KB_TO_MB, pageCache: cachedMb * FOUR_KB_TO_MB, size: int64(sizeMb) * 1024 * 1024,
+		shardCount: shards, priStore: storeStat{segments: segments}, fileSuffixStat: FileSuffixStat{}}
+}
+
+func TestAdviseIndex(t *testing.T) {
+	es7 := ClusterVersion{Distribution: DISTRIBUTION_ELASTICSEARCH, Number: "7.17.0", Major: 7, Minor: 17}
+	es8 := ClusterVersion{Distribution: DISTRIBUTION_ELASTICSEARCH, Number: "8.11.0", Major: 8, Minor: 11}
+	opensearch := ClusterVersion{Distribution: DISTRIBUTION_OPENSEARCH, Number: "2.11.0", Major: 2, Minor: 11}
+	history := map[string]CacheHistory{
+		"busy":    {MaxCache: 90, AvgCache: 60, Cycles: 10},
+		"touched": {MaxCache: 20, AvgCache: 5, Cycles: 10},
+		"idle":    {MaxCache: 0, AvgCache: 0, Cycles: 10},
+	}
+	tests := []struct {
+		index   Index
+		tier    string
+		version ClusterVersion
+		class   string
+		actions []string
+	}{
+		{newAdviseIndex("cached", 100, 60, 4, 2), "hot", es7, INDEX_HOT, []string{}},
+		{newAdviseIndex("busy", 100, 10, 40, 2), "hot", es7, INDEX_HOT, []string{}},
+		{newAdviseIndex("touched", 100, 0, 4, 2), "hot", es7, INDEX_WARM, []string{"move to warm tier"}},
+		{newAdviseIndex("touched", 100, 0, 40, 2), "warm", es7, INDEX_WARM, []string{"force-merge"}},
+		{newAdviseIndex("idle", 100, 0, 4, 2), "", es7, INDEX_COLD, []string{"move to warm tier", "close or freeze"}},
+		{newAdviseIndex("new", 100, 1, 4, 2), "content", es7, INDEX_COLD, []string{"move to warm tier", "close or freeze"}},
+		{newAdviseIndex("idle", 100, 0, 40, 2), "cold", es7, INDEX_COLD, []string{"close or freeze", "force-merge"}},
+		{newAdviseIndex("idle", 100, 0, 4, 2), "hot", es8, INDEX_COLD, []string{"move to warm tier", "close"}},
+		{newAdviseIndex("idle", 100, 0, 4, 2), "hot", opensearch, INDEX_COLD, []string{"move to warm tier", "close"}},
+		{newAdviseIndex("idle", 100, 0, 4, 2), "hot", ClusterVersion{}, INDEX_COLD, []string{"move to warm tier", "close"}},
+	}
+	for _, test := range tests {
+		options := DEFAULT_ADVISE_OPTIONS
+		options.Version = test.version
+		advice := adviseIndex(test.index, history, test.tier, options)
+		if advice.Class != test.class || !reflect.DeepEqual(advice.Actions, test.actions) {
+			t.Errorf("adviseIndex(%s) on tier %q of %s = %s %q, want %s %q", test.index.indexName, test.tier, test.version,
+				advice.Class, advice.Actions, test.class, test.actions)
+		}
+	}
+
+	preloaded := newAdviseIndex("preloaded", 100, 60, 4, 2)
+	preloaded.fileSuffixStat["tim"] = FileSuffixCache{suffixName: "tim", pageCache: 100}
+	advice := adviseIndex(preloaded, history, "hot", DEFAULT_ADVISE_OPTIONS)
+	if want := []string{"enable index.store.preload for tim"}; !reflect.DeepEqual(advice.Actions, want) {
+		t.Errorf("adviseIndex(preloaded) actions = %q, want %q", advice.Actions, want)
+	}
+}
+
+func TestGetPreloadSuffixes(t *testing.T) {
+	tests := []struct {
+		cache    map[string]int
+		suffixes []string
+	}{
+		{map[string]int{}, []string{}},
+		{map[string]int{"fdt": 1000, "tim": 0}, []string{}},
+		{map[string]int{"dvd": 10}, []string{"dvd"}},
+		{map[string]int{"tim": 300, "doc": 500, "nvd": 100, "fdt": 1000}, []string{"doc", "tim"}},
+		{map[string]int{"tim": 200, "dim": 200, "dvd": 100}, []string{"tim", "dim"}},
+	}
+	for _, test := range tests {
+		index := newAdviseIndex("logs", 100, 100, 4, 2)
+		for suffix, cache := range test.cache {
+			index.fileSuffixStat[suffix] = FileSuffixCache{suffixName: suffix, pageCache: cache}
+		}
+		if suffixes := getPreloadSuffixes(index); !reflect.DeepEqual(suffixes, test.suffixes) {
+			t.Errorf("getPreloadSuffixes(%v) = %q, want %q", test.cache, suffixes, test.suffixes)
+		}
+	}
+}
+
+func TestGetCacheHistory(t *testing.T) {
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"aggregations":{"indices":{"buckets":[
+			{"key":"logs","doc_count":4,"cycle_cache":{"buckets":[]},"max_cache":{"value":30.0},"avg_cache":{"value":25.0},"cycles":{"value":2}}
+		]}}}`))
+	}))
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := GetCacheHistory(client, "pcstat", "node-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (CacheHistory{MaxCache: 30, AvgCache: 25, Cycles: 2}); history["logs"] != want {
+		t.Errorf("history of logs = %+v, want %+v", history["logs"], want)
+	}
+	//max and avg are taken over the per cycle sums
+	aggs := request["aggs"].(map[string]interface{})["indices"].(map[string]interface{})["aggs"].(map[string]interface{})
+	for _, name := range []string{"max_cache", "avg_cache"} {
+		agg := aggs[name].(map[string]interface{})
+		for _, bucketAgg := range agg {
+			if path := bucketAgg.(map[string]interface{})["buckets_path"]; path != "cycle_cache>cache" {
+				t.Errorf("%s buckets_path = %v, want cycle_cache>cache", name, path)
+			}
+		}
+	}
+}
@@ -3,56 +3,36 @@ package es_collect
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/olivere/elastic.v6"
 )
 
 var PCSTAT_INDEX_NAME = "pc_stat"
 var KEEP_INDEX_NUM = 5
 
-var mapping = `
-	{
-		"settings":{
-			"number_of_replicas":0
-		},
-		"mappings":{
-			"_doc":{
-				"properties":{
-					"cluster_name" : {
-						"type" : "keyword"
-					  },
-					  "created" : {
-						"type" : "date"
-					  },
-					  "index_name" : {
-						"type" : "keyword"
-					  },
-					  "node_name" : {
-						"type" : "keyword"
-					  }
-				}
-			}
-		}
-	}
-`
-
 //es client for get shards or indices and more
+//scheme is http or https, es 8.x enables https and security by default
 type Client struct {
+	Scheme   string
 	Ip       string
 	Port     string
 	User     string
 	Password string
 }
 
-func CollectClient(ip string, port string, user string, password string) *Client {
+func CollectClient(scheme string, ip string, port string, user string, password string) *Client {
 	instance := new(Client)
+	if scheme == "" {
+		scheme = "http"
+	}
+	instance.Scheme = scheme
 	instance.Ip = ip
 	instance.Port = port
 	instance.User = user
@@ -60,72 +40,128 @@ func CollectClient(ip string, port string, user string, password string) *Client
 	return instance
 }
 
-func OutputClient(ip string, port string, user string, password string) elastic.Client {
-	url := "http://" + ip + ":" + port + "/"
-	client, err := elastic.NewClient(
+//scheme is http or https, certificates are not verified for https like the collect client
+func OutputClient(scheme string, ip string, port string, user string, password string) (*elastic.Client, error) {
+	if scheme == "" {
+		scheme = "http"
+	}
+	url := scheme + "://" + ip + ":" + port + "/"
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	return elastic.NewClient(
 		elastic.SetURL(url),
+		elastic.SetScheme(scheme),
+		elastic.SetHttpClient(&http.Client{Timeout: 60 * time.Second, Transport: tr}),
 		elastic.SetSniff(false),
 		elastic.SetHealthcheckInterval(10*time.Second),
 		elastic.SetBasicAuth(user, password),
 		elastic.SetGzip(true),
-		elastic.SetErrorLog(log.New(os.Stderr, "ELASTIC ", log.LstdFlags)),
-		elastic.SetInfoLog(log.New(os.Stdout, "", log.LstdFlags)))
-	if err != nil {
-		panic(err)
-	}
+		elastic.SetErrorLog(elasticLogger{level: log.ErrorLevel}),
+		elastic.SetInfoLog(elasticLogger{level: log.DebugLevel}))
+}
 
-	return *client
+func (client Client) getUrl(path string) string {
+	return client.Scheme + "://" + client.Ip + ":" + client.Port + path
+}
+
+const (
+	SHARD_STATE_STARTED      = "STARTED"
+	SHARD_STATE_RELOCATING   = "RELOCATING"
+	SHARD_STATE_INITIALIZING = "INITIALIZING"
+)
 
+//row of _cat/shards?format=json, node is null for unassigned shards
+type catShardRow struct {
+	State  string  `json:"state"`
+	Index  string  `json:"index"`
+	Shard  string  `json:"shard"`
+	Node   *string `json:"node"`
+	Prirep string  `json:"prirep"`
+	Docs   *string `json:"docs"`
+	Store  *string `json:"store"`
+}
+
+type catIndexRow struct {
+	Index        string `json:"index"`
+	Uuid         string `json:"uuid"`
+	Status       string `json:"status"`
+	CreationDate string `json:"creation.date"`
 }
 
 func GetShardMap(client Client) ShardMap {
-	url := "http://" + client.Ip + ":" + client.Port + "/_cat/shards?h=state,index,shard,node,prirep"
+	url := client.getUrl("/_cat/shards?format=json&bytes=b&h=state,index,shard,node,prirep,docs,store")
+	shardMap := ShardMap{}
 	body, err := httpGetRequest(url, client.User, client.Password)
 	if err != nil {
-		log.Printf("get indices error,%v", err)
+		countError(ERROR_ES_API, "get shards error, %v", err)
+		return shardMap
+	}
+	rows := make([]catShardRow, 0)
+	if err := json.Unmarshal([]byte(body), &rows); err != nil {
+		countError(ERROR_ES_API, "parse shards error, %v", err)
+		return shardMap
 	}
-	lines := splitWithoutNull(body, "\n")
 
-	shardMap := ShardMap{}
-	for _, shardStr := range lines {
-		columns := splitWithoutNull(shardStr, " ")
-		state := columns[0]
-		if strings.Compare(state, "STARTED") != 0 {
+	for _, row := range rows {
+		if row.Node == nil || *row.Node == "" {
 			continue
 		}
-		indexName := columns[1]
-		nodeName := columns[3]
-		shardId := columns[2]
-		prirep := columns[4]
-		primary := false
-		if prirep == "p" {
-			primary = true
+		primary := row.Prirep == "p"
+		store := storeStat{docs: parseCatNumber(row.Docs), storeSize: parseCatNumber(row.Store)}
+		switch row.State {
+		case SHARD_STATE_STARTED, SHARD_STATE_INITIALIZING:
+			shard := Shard{indexName: row.Index, nodeName: *row.Node, shardId: row.Shard, primary: primary, state: row.State, store: store}
+			shardMap[shard.getShardKey()] = shard
+		case SHARD_STATE_RELOCATING:
+			//node is "source -> target_ip target_id target_name", both nodes have the files on disk
+			//the copy on the target is still initializing until the relocation is done, docs and store of the row are the source's
+			sourceNode, targetNode := parseRelocatingNode(*row.Node)
+			shard := Shard{indexName: row.Index, nodeName: sourceNode, shardId: row.Shard, primary: primary, state: SHARD_STATE_RELOCATING,
+				store: store}
+			shardMap[shard.getShardKey()] = shard
+			if targetNode != "" {
+				target := Shard{indexName: row.Index, nodeName: targetNode, shardId: row.Shard, primary: primary, state: SHARD_STATE_INITIALIZING}
+				shardMap[target.getShardKey()] = target
+			}
 		}
-		shard := Shard{indexName: indexName, nodeName: nodeName, shardId: shardId, primary: primary}
-		shardKey := shard.getShardKey()
-		shardMap[shardKey] = shard
-		//log.Printf("%s , %s ,%s",columns[0], columns[1] ,columns[2])
 	}
 	return shardMap
 }
 
+//target is "" if node is malformed, like "source ->" without the target
+func parseRelocatingNode(node string) (string, string) {
+	parts := strings.SplitN(node, "->", 2)
+	sourceNode := strings.TrimSpace(parts[0])
+	if len(parts) < 2 {
+		return sourceNode, ""
+	}
+	target := strings.Fields(parts[1])
+	if len(target) < 3 {
+		return sourceNode, ""
+	}
+	return sourceNode, strings.Join(target[2:], " ")
+}
+
 func GetIndiceMap(client Client, indicesPrefix []string) IndexMap {
-	url := "http://" + client.Ip + ":" + client.Port + "/_cat/indices?h=index,uuid"
+	url := client.getUrl("/_cat/indices?format=json&h=index,uuid,status,creation.date")
+	indexMap := IndexMap{}
 	body, err := httpGetRequest(url, client.User, client.Password)
 	if err != nil {
-		log.Printf("get indices error,%v", err)
+		countError(ERROR_ES_API, "get indices error, %v", err)
+		return indexMap
+	}
+	rows := make([]catIndexRow, 0)
+	if err := json.Unmarshal([]byte(body), &rows); err != nil {
+		countError(ERROR_ES_API, "parse indices error, %v", err)
+		return indexMap
 	}
-	lines := splitWithoutNull(body, "\n")
 
-	indexMap := IndexMap{}
-	for _, indexStr := range lines {
-		columns := splitWithoutNull(indexStr, " ")
-		indexName := columns[0]
-		uuid := columns[1]
-		if checkInIndices(indexName, indicesPrefix) {
-			indexMap[indexName] = Index{indexName: indexName, uuid: uuid}
+	for _, row := range rows {
+		if checkInIndices(row.Index, indicesPrefix) {
+			indexMap[row.Index] = Index{indexName: row.Index, uuid: row.Uuid, closed: row.Status == INDEX_STATUS_CLOSE,
+				creationDate: parseCatNumber(&row.CreationDate)}
 		}
-		//log.Printf("%s , %s",columns[0], columns[1])
 	}
 	return indexMap
 }
@@ -154,89 +190,146 @@ func FillShardMapFilterNode(shardMap ShardMap, indexMap IndexMap, nodeName strin
 			continue
 		}
 		shard.uuid = index.uuid
+		shard.creationDate = index.creationDate
+		shard.closed = index.closed
 		shardMap[key] = shard
 	}
 	return shardMap
 }
 
-//split and skip empty String ""
-func splitWithoutNull(s, sep string) []string {
-	strs := strings.Split(s, sep)
-	res := make([]string, 0)
-	for _, str := range strs {
-		if strings.Compare(str, "") != 0 {
-			res = append(res, str)
-		}
-	}
-	return res
-}
-
-func initPcstatIndex(esClient elastic.Client, indexPrefix string) (string, error) {
+//create the daily index of created, replayed docs of an old cycle go to the index of their own day
+func initPcstatIndex(esClient *elastic.Client, version ClusterVersion, indexPrefix string, created time.Time) (string, error) {
 	//create index if not exist
-	realIndex := indexPrefix + "-" + time.Now().Format("2006_01_02")
+	realIndex := indexPrefix + "-" + created.Format("2006_01_02")
+	if isExpired(created, time.Now()) {
+		return realIndex, fmt.Errorf("index is out of keepIndexNum, index_name: %s", realIndex)
+	}
 	exist, err := esClient.IndexExists(realIndex).Do(context.TODO())
 	if err != nil {
-		fmt.Errorf("check index exists error,index_name: %s, %s", realIndex, err)
+		return realIndex, fmt.Errorf("check index exists error,index_name: %s, %v", realIndex, err)
 	}
 	if !exist {
-		createIndex, err := esClient.CreateIndex(realIndex).Body(mapping).IncludeTypeName(true).Do(context.TODO())
+		body := map[string]interface{}{
+			"settings": map[string]interface{}{"number_of_replicas": 0},
+			"mappings": getPcstatMappings(version),
+		}
+		//typed mappings are the default of es 6.x, which rejects include_type_name before 6.7
+		createIndex, err := esClient.CreateIndex(realIndex).BodyJson(body).Do(context.TODO())
 		if err != nil || createIndex == nil || !createIndex.Acknowledged {
-			fmt.Errorf("create index error error, index_name: %s, %s", realIndex, err)
-			return realIndex, &elastic.Error{Status: 500}
+			return realIndex, fmt.Errorf("create index error, index_name: %s, %v", realIndex, err)
 		}
 	}
 
-	//detele index if exist
-	dayBefore := time.Now().AddDate(0, 0, -KEEP_INDEX_NUM-1)
-	toDeleteIndex := indexPrefix + "-" + dayBefore.Format("2006_01_02")
-	deleteExist, _ := esClient.IndexExists(toDeleteIndex).Do(context.TODO())
-	if deleteExist {
-		deleteIndex, error := esClient.DeleteIndex(toDeleteIndex).Do(context.TODO())
-		if error != nil || deleteIndex == nil || !deleteIndex.Acknowledged {
-			fmt.Errorf("delete index error error, index_name: %s, %s", toDeleteIndex, error)
-		}
+	deleted, err := sweepExpiredIndices(esClient, indexPrefix, time.Now())
+	if err != nil {
+		Diag.Warnf("sweep expired index error, %v", err)
+	}
+	for _, index := range deleted {
+		Diag.Infof("deleted expired index, index_name: %s", index)
 	}
 	return realIndex, nil
 }
 
-func PostPcstatData(client elastic.Client, docs []PageCacheDoc) {
-	esClient := client
-	indexName, error := initPcstatIndex(esClient, PCSTAT_INDEX_NAME)
-	if error != nil {
-		fmt.Printf("create index error, skip bulk data, %s\n", error)
-		return
+//delete every indexPrefix-yyyy_MM_dd index older than KEEP_INDEX_NUM days, returns the deleted index names
+//indices the agent missed while it was down or kept by a bigger keepIndexNum are removed as well
+func sweepExpiredIndices(esClient *elastic.Client, indexPrefix string, now time.Time) ([]string, error) {
+	deleted := make([]string, 0)
+	rows, err := esClient.CatIndices().Index(indexPrefix + "-*").Columns("index").Do(context.TODO())
+	if err != nil {
+		return deleted, fmt.Errorf("list index error, pattern: %s-*, %v", indexPrefix, err)
+	}
+	var lastErr error
+	for _, row := range rows {
+		date, err := time.ParseInLocation("2006_01_02", strings.TrimPrefix(row.Index, indexPrefix+"-"), now.Location())
+		if err != nil || !isExpired(date, now) {
+			continue
+		}
+		deleteIndex, err := esClient.DeleteIndex(row.Index).Do(context.TODO())
+		if err != nil || deleteIndex == nil || !deleteIndex.Acknowledged {
+			lastErr = fmt.Errorf("delete index error, index_name: %s, %v", row.Index, err)
+			continue
+		}
+		deleted = append(deleted, row.Index)
+	}
+	return deleted, lastErr
+}
+
+//whether the day of date is older than KEEP_INDEX_NUM days before now
+func isExpired(date time.Time, now time.Time) bool {
+	today, _ := time.ParseInLocation("2006_01_02", now.Format("2006_01_02"), now.Location())
+	oldestKept := today.AddDate(0, 0, -KEEP_INDEX_NUM)
+	return date.Before(oldestKept)
+}
+
+//docs are of one cycle, they are written to the daily index of their created time, the failed docs are returned
+func PostPcstatData(esClient *elastic.Client, version ClusterVersion, docs []PageCacheDoc) ([]PageCacheDoc, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	indexName, err := initPcstatIndex(esClient, version, PCSTAT_INDEX_NAME, docs[0].Created)
+	if err != nil {
+		return docs, outputError{category: ERROR_ES_API, err: fmt.Errorf("create index error, skip bulk data, %v", err)}
 	}
 
 	bulkRequest := esClient.Bulk()
 	for _, doc := range docs {
-		indexReq := elastic.NewBulkIndexRequest().Index(indexName).Type("_doc").Doc(doc)
+		indexReq := elastic.NewBulkIndexRequest().Index(indexName).Id(doc.id()).Doc(doc)
+		if version.typed() {
+			indexReq = indexReq.Type("_doc")
+		}
 		bulkRequest = bulkRequest.Add(indexReq)
 	}
 
+	return doBulk(bulkRequest, docs)
+}
+
+//the same doc of a cycle always gets the same id, so a batch written again never duplicates docs
+func (doc PageCacheDoc) id() string {
+	role := "replica"
+	if doc.Primary {
+		role = "primary"
+	}
+	return fmt.Sprintf("%d_%s_%s_%s", doc.Created.UnixNano(), doc.NodeName, doc.IndexName, role)
+}
+
+//docs are in the order of the bulk requests, the failed ones are returned.
+//all docs are failed if the request fails, some may be written already and are overwritten by their id later
+func doBulk(bulkRequest *elastic.BulkService, docs []PageCacheDoc) ([]PageCacheDoc, error) {
 	bulkResponse, err := bulkRequest.Do(context.TODO())
+	if err != nil {
+		return docs, outputError{category: ERROR_BULK, err: fmt.Errorf("bulk es data error, %v", err)}
+	}
 	if bulkResponse == nil {
-		fmt.Errorf("expected bulkResponse to be != nil; got nil")
-		return
+		return docs, outputError{category: ERROR_BULK, err: fmt.Errorf("expected bulkResponse to be != nil; got nil")}
 	}
-	if err != nil {
-		fmt.Errorf("bulk es data error, %s", err)
+	if !bulkResponse.Errors {
+		return nil, nil
 	}
-	if bulkResponse.Errors {
-		fmt.Errorf("bulk error")
-		for _, typeItem := range bulkResponse.Items {
-			for _, item := range typeItem {
-				fmt.Errorf(item.Error.Reason)
+	failed := make([]PageCacheDoc, 0)
+	reason := ""
+	for i, item := range bulkResponse.Items {
+		for _, result := range item {
+			//a create of a doc written by an earlier try
+			if result.Status == http.StatusConflict || result.Status < 300 || i >= len(docs) {
+				continue
+			}
+			failed = append(failed, docs[i])
+			if reason == "" && result.Error != nil {
+				reason = result.Error.Reason
 			}
 		}
 	}
+	if len(failed) == 0 {
+		return nil, nil
+	}
+	return failed, outputError{category: ERROR_BULK, err: fmt.Errorf("bulk error, %d of %d docs failed, %s", len(failed), len(docs), reason)}
 }
 
 func httpGetRequest(url string, user string, password string) (string, error) {
 	rep, err := http.NewRequest("GET", url, nil)
 	// req.Header.Set("X-Custom-Header", "myvalue")
 	if err != nil {
-		fmt.Println("req err:")
-		panic(err)
+		return "", fmt.Errorf("create request %s error, %v", url, err)
 	}
 	//设置用户密码和跳过tls
 	rep.SetBasicAuth(user, password)
@@ -255,6 +348,10 @@ func httpGetRequest(url string, user string, password string) (string, error) {
 		// handle error
 		return "", err
 	}
+	//401 of a secured cluster or 404 of an unknown api is not data
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("request %s error, status %s, %s", url, resp.Status, body)
+	}
 	return string(body), nil
 }
 
@@ -264,5 +361,26 @@ type PageCacheDoc struct {
 	ClusterName string         `json:"cluster_name"`
 	NodeName    string         `json:"node_name"`
 	IndexName   string         `json:"index_name"`
+	Group       string         `json:"group,omitempty"`
 	Created     time.Time      `json:"created,omitempty"`
+	//errors of the cycle by category, only in the primary doc of total
+	Errors ErrorStats `json:"errors,omitempty"`
+	//cache of shards in recovery or relocation by state, MB, started shards are only in cache
+	State map[string]int `json:"state,omitempty"`
+	//docs, store and segments of the shards on the node, ratios are MB of cache per GB stored and per million docs
+	Docs                int64   `json:"docs"`
+	StoreSize           int64   `json:"store_size"`
+	Segments            int     `json:"segments"`
+	SegmentMemory       int64   `json:"segment_memory"`
+	CachePerGb          float64 `json:"cache_per_gb"`
+	CachePerMillionDocs float64 `json:"cache_per_million_docs"`
+	//cache of segment files by segment state (live, unsearchable, committed, merged, new, other), MB, only if _cat/segments is got
+	SegmentCache map[string]int `json:"segment_cache,omitempty"`
+	//cache of files hard-linked with other indices by shrink, split or clone, MB, and those indices
+	SharedCache int      `json:"shared_cache,omitempty"`
+	SharedWith  []string `json:"shared_with,omitempty"`
+	//roles, custom attributes and data tier of the node
+	NodeRoles      []string          `json:"node_roles,omitempty"`
+	NodeAttributes map[string]string `json:"node_attributes,omitempty"`
+	NodeTier       string            `json:"node_tier,omitempty"`
 }
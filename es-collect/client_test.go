@@ -0,0 +1,90 @@
+package es_collect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+//es stand-in answering every request with the body of its path, 404 for other paths
+func newTestClient(t *testing.T, bodies map[string]string) (Client, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, exist := bodies[r.URL.Path]
+		if !exist {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	serverUrl, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *CollectClient(serverUrl.Scheme, serverUrl.Hostname(), serverUrl.Port(), "", ""), server
+}
+
+func TestParseRelocatingNode(t *testing.T) {
+	tests := []struct {
+		node   string
+		source string
+		target string
+	}{
+		{"node-1 -> 10.0.0.2 Zr3sYtIgTk6RGiGz2PfG5A node-2", "node-1", "node-2"},
+		{"node-1 -> 10.0.0.2 Zr3sYtIgTk6RGiGz2PfG5A es node 2", "node-1", "es node 2"},
+		{"node-1", "node-1", ""},
+		{"node-1 ->", "node-1", ""},
+		{"node-1 -> ", "node-1", ""},
+		{"node-1 -> 10.0.0.2 Zr3sYtIgTk6RGiGz2PfG5A", "node-1", ""},
+	}
+	for _, test := range tests {
+		source, target := parseRelocatingNode(test.node)
+		if source != test.source || target != test.target {
+			t.Errorf("parseRelocatingNode(%q) = %q, %q, want %q, %q", test.node, source, target, test.source, test.target)
+		}
+	}
+}
+
+func TestGetShardMap(t *testing.T) {
+	client, server := newTestClient(t, map[string]string{"/_cat/shards": `[
+		{"state":"STARTED","index":"logs","shard":"0","node":"node-1","prirep":"p","docs":"100","store":"2048"},
+		{"state":"RELOCATING","index":"logs","shard":"1","node":"node-1 -> 10.0.0.2 Zr3sYtIgTk6RGiGz2PfG5A node-2","prirep":"r","docs":"50","store":"1024"},
+		{"state":"RELOCATING","index":"logs","shard":"2","node":"node-1 ->","prirep":"p","docs":"10","store":"512"},
+		{"state":"UNASSIGNED","index":"logs","shard":"3","node":null,"prirep":"r","docs":null,"store":null},
+		{"state":"INITIALIZING","index":"metrics","shard":"0","node":"node-2","prirep":"p","docs":null,"store":null}
+	]`})
+	defer server.Close()
+	TakeErrorStats()
+	shardMap := GetShardMap(client)
+	if errors := TakeErrorStats(); errors.total() != 0 {
+		t.Errorf("errors = %v, want none", errors)
+	}
+
+	tests := []struct {
+		key     string
+		state   string
+		primary bool
+		docs    int64
+	}{
+		{"logs|0|node-1", SHARD_STATE_STARTED, true, 100},
+		{"logs|1|node-1", SHARD_STATE_RELOCATING, false, 50},
+		{"logs|1|node-2", SHARD_STATE_INITIALIZING, false, 0},
+		{"logs|2|node-1", SHARD_STATE_RELOCATING, true, 10},
+		{"metrics|0|node-2", SHARD_STATE_INITIALIZING, true, 0},
+	}
+	if len(shardMap) != len(tests) {
+		t.Errorf("got %d shards, want %d: %v", len(shardMap), len(tests), shardMap)
+	}
+	for _, test := range tests {
+		shard, exist := shardMap[test.key]
+		if !exist {
+			t.Errorf("shard %s is missing", test.key)
+			continue
+		}
+		if shard.state != test.state || shard.primary != test.primary || shard.store.docs != test.docs {
+			t.Errorf("shard %s = %s primary %v docs %d, want %s primary %v docs %d", test.key,
+				shard.state, shard.primary, shard.store.docs, test.state, test.primary, test.docs)
+		}
+	}
+}
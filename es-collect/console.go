@@ -0,0 +1,137 @@
+package es_collect
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	COLUMN_CACHE   = "cache"
+	COLUMN_PRI     = "pri"
+	COLUMN_REP     = "rep"
+	COLUMN_SIZE    = "size"
+	COLUMN_PERCENT = "percent"
+	COLUMN_SHARDS  = "shards"
+	COLUMN_DELTA   = "delta"
+
+	COLUMN_RELOCATING   = "relocating"
+	COLUMN_INITIALIZING = "initializing"
+
+	COLUMN_DOCS                   = "docs"
+	COLUMN_STORE                  = "store"
+	COLUMN_SEGMENTS               = "segments"
+	COLUMN_CACHE_PER_GB           = "cache_per_gb"
+	COLUMN_CACHE_PER_MILLION_DOCS = "cache_per_mdocs"
+
+	COLUMN_MERGED       = "merged"
+	COLUMN_UNSEARCHABLE = "unsearchable"
+	COLUMN_COMMITTED    = "committed"
+	COLUMN_NEW          = "new"
+
+	COLUMN_SHARED = "shared"
+)
+
+//columns printed when none is configured
+var DEFAULT_CONSOLE_COLUMNS = []string{COLUMN_CACHE, COLUMN_PRI, COLUMN_REP}
+
+//one column of the console table, last is the same index in the previous cycle and may be nil
+type consoleColumn struct {
+	title string
+	value func(index Index, last *Index) string
+}
+
+var consoleColumns = map[string]consoleColumn{
+	COLUMN_CACHE: {title: "cache (MB)", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.pageCache/FOUR_KB_TO_MB)
+	}},
+	COLUMN_PRI: {title: "pri cache", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.priPageCache/FOUR_KB_TO_MB)
+	}},
+	COLUMN_REP: {title: "rep cache", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.repPageCache/FOUR_KB_TO_MB)
+	}},
+	COLUMN_SIZE: {title: "size (MB)", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.size/1024/1024)
+	}},
+	COLUMN_PERCENT: {title: "cached %", value: func(index Index, last *Index) string {
+		if index.pages == 0 {
+			return "0.00"
+		}
+		return fmt.Sprintf("%.2f", float64(index.pageCache)/float64(index.pages)*100)
+	}},
+	COLUMN_SHARDS: {title: "shards", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.shardCount)
+	}},
+	COLUMN_DELTA: {title: "delta (MB)", value: func(index Index, last *Index) string {
+		if last == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%+d", index.pageCache/FOUR_KB_TO_MB-last.pageCache/FOUR_KB_TO_MB)
+	}},
+	COLUMN_RELOCATING: {title: "relocating", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.stateCache(SHARD_STATE_RELOCATING)/FOUR_KB_TO_MB)
+	}},
+	COLUMN_INITIALIZING: {title: "initializing", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.stateCache(SHARD_STATE_INITIALIZING)/FOUR_KB_TO_MB)
+	}},
+	COLUMN_DOCS: {title: "docs", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.store().docs)
+	}},
+	COLUMN_STORE: {title: "store (MB)", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.store().storeSize/1024/1024)
+	}},
+	COLUMN_SEGMENTS: {title: "segments", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.store().segments)
+	}},
+	COLUMN_CACHE_PER_GB: {title: "cache/GB", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%.2f", cachePerGb(index.pageCache, index.store().storeSize))
+	}},
+	COLUMN_CACHE_PER_MILLION_DOCS: {title: "cache/Mdocs", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%.2f", cachePerMillionDocs(index.pageCache, index.store().docs))
+	}},
+	COLUMN_MERGED: {title: "merged", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.segmentCache(SEGMENT_MERGED)/FOUR_KB_TO_MB)
+	}},
+	COLUMN_UNSEARCHABLE: {title: "unsearchable", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.segmentCache(SEGMENT_UNSEARCHABLE)/FOUR_KB_TO_MB)
+	}},
+	COLUMN_COMMITTED: {title: "committed", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.segmentCache(SEGMENT_COMMITTED)/FOUR_KB_TO_MB)
+	}},
+	COLUMN_NEW: {title: "new", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", index.segmentCache(SEGMENT_NEW)/FOUR_KB_TO_MB)
+	}},
+	COLUMN_SHARED: {title: "shared", value: func(index Index, last *Index) string {
+		return fmt.Sprintf("%d", (index.priSharedCache+index.repSharedCache)/FOUR_KB_TO_MB)
+	}},
+}
+
+//any name that is not a known column is taken as a file suffix, like tim,doc,dvd
+func getConsoleColumns(columnNames []string) []consoleColumn {
+	columns := make([]consoleColumn, 0)
+	for _, name := range columnNames {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		column, exist := consoleColumns[name]
+		if !exist {
+			column = suffixColumn(name)
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return getConsoleColumns(DEFAULT_CONSOLE_COLUMNS)
+	}
+	return columns
+}
+
+func suffixColumn(suffixName string) consoleColumn {
+	return consoleColumn{title: suffixName, value: func(index Index, last *Index) string {
+		fileSuffixCache, exist := index.fileSuffixStat[suffixName]
+		if !exist {
+			return "0"
+		}
+		return fmt.Sprintf("%d", fileSuffixCache.pageCache/FOUR_KB_TO_MB)
+	}}
+}
@@ -0,0 +1,89 @@
+package es_collect
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+//category of the cache of files that are deleted but still open by es
+const DELETED_SUFFIX = "deleted"
+
+var deletedMark = " (deleted)"
+
+//segment files unlinked by merges but still open by es, key is uuid/shardId
+type DeletedFiles map[string][]deletedFile
+
+//fd is the /proc/<pid>/fd/<n> path, it can be opened even if the file has no name any more,
+//name is the name the file had in the shard directory
+type deletedFile struct {
+	fd   string
+	name string
+}
+
+//scan the fds of pid for deleted files under an indices directory, every file is kept once
+//even if many fds open it. /proc is only on linux, other systems find nothing
+func GetDeletedFiles(pid int) DeletedFiles {
+	deletedFiles := DeletedFiles{}
+	if pid <= 0 {
+		return deletedFiles
+	}
+	fdPath := fmt.Sprintf("/proc/%d/fd", pid)
+	fds, err := ioutil.ReadDir(fdPath)
+	if err != nil {
+		countError(ERROR_READDIR, "read dir error, dir : %q , %v", fdPath, err)
+		return deletedFiles
+	}
+	seen := map[string]bool{}
+	for _, fd := range fds {
+		fdFile := fdPath + "/" + fd.Name()
+		target, err := os.Readlink(fdFile)
+		if err != nil || !strings.HasSuffix(target, deletedMark) {
+			continue
+		}
+		target = strings.TrimSuffix(target, deletedMark)
+		if seen[target] {
+			continue
+		}
+		key, ok := getDeletedShardKey(target)
+		if !ok {
+			continue
+		}
+		seen[target] = true
+		deletedFiles[key] = append(deletedFiles[key], deletedFile{fd: fdFile, name: path.Base(target)})
+		Diag.Debugf("found deleted file %q open by %q", target, fdFile)
+	}
+	return deletedFiles
+}
+
+//files of a shard are <indices>/<uuid>/<shardId>/index/<file>
+func getDeletedShardKey(file string) (string, bool) {
+	indexDir := path.Dir(file)
+	if path.Base(indexDir) != "index" {
+		return "", false
+	}
+	shardDir := path.Dir(indexDir)
+	uuidDir := path.Dir(shardDir)
+	if path.Base(path.Dir(uuidDir)) != "indices" {
+		return "", false
+	}
+	return path.Base(uuidDir) + "/" + path.Base(shardDir), true
+}
+
+//give every shard the deleted files of its directory
+func (shardMap ShardMap) FillDeletedFiles(deletedFiles DeletedFiles) ShardMap {
+	if len(deletedFiles) == 0 {
+		return shardMap
+	}
+	for key, shard := range shardMap {
+		files, exist := deletedFiles[shard.uuid+"/"+shard.shardId]
+		if !exist {
+			continue
+		}
+		shard.deletedFiles = files
+		shardMap[key] = shard
+	}
+	return shardMap
+}
@@ -0,0 +1,24 @@
+package es_collect
+
+import "testing"
+
+func TestGetDeletedShardKey(t *testing.T) {
+	tests := []struct {
+		file string
+		key  string
+		ok   bool
+	}{
+		{"/data/nodes/0/indices/Zr3sYtIgTk6RGiGz2PfG5A/0/index/_1k.fdt", "Zr3sYtIgTk6RGiGz2PfG5A/0", true},
+		{"/data/indices/Zr3sYtIgTk6RGiGz2PfG5A/3/index/_1k_Lucene90_0.tim", "Zr3sYtIgTk6RGiGz2PfG5A/3", true},
+		{"/data/indices/Zr3sYtIgTk6RGiGz2PfG5A/0/translog/translog-5.tlog", "", false},
+		{"/data/indices/Zr3sYtIgTk6RGiGz2PfG5A/_state/state-1.st", "", false},
+		{"/tmp/backup/Zr3sYtIgTk6RGiGz2PfG5A/0/index/_1k.fdt", "", false},
+		{"/data/nodes/0/_state/node-1.st", "", false},
+	}
+	for _, test := range tests {
+		key, ok := getDeletedShardKey(test.file)
+		if key != test.key || ok != test.ok {
+			t.Errorf("getDeletedShardKey(%q) = %q, %v, want %q, %v", test.file, key, ok, test.key, test.ok)
+		}
+	}
+}
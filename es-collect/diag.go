@@ -0,0 +1,99 @@
+package es_collect
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//error categories counted every cycle
+const (
+	ERROR_ES_API  = "es_api"
+	ERROR_READDIR = "readdir"
+	ERROR_MMAP    = "mmap"
+	ERROR_BULK    = "bulk"
+	ERROR_OUTPUT  = "output"
+)
+
+var errorCategories = []string{ERROR_ES_API, ERROR_READDIR, ERROR_MMAP, ERROR_BULK, ERROR_OUTPUT}
+
+//leveled diagnostic logger of the agent itself, it writes to stderr and never to the data outputs
+var Diag = newDiagLogger()
+
+func newDiagLogger() *log.Logger {
+	logger := log.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	logger.SetLevel(log.InfoLevel)
+	return logger
+}
+
+func SetDiagLevel(level string) error {
+	logLevel, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	Diag.SetLevel(logLevel)
+	return nil
+}
+
+//error count of every category, errors of es output are counted when the sink runs,
+//so they show up in the cycle after the one they were written for
+type ErrorStats map[string]int
+
+var errorStats = ErrorStats{}
+var errorStatsLock sync.Mutex
+
+//count one error of category and log it
+func countError(category string, format string, args ...interface{}) {
+	errorStatsLock.Lock()
+	errorStats[category]++
+	errorStatsLock.Unlock()
+	Diag.WithField("category", category).Errorf(format, args...)
+}
+
+//errors counted since the last call, every category is present
+func TakeErrorStats() ErrorStats {
+	errorStatsLock.Lock()
+	defer errorStatsLock.Unlock()
+	taken := ErrorStats{}
+	for _, category := range errorCategories {
+		taken[category] = errorStats[category]
+	}
+	errorStats = ErrorStats{}
+	return taken
+}
+
+func (errors ErrorStats) total() int {
+	total := 0
+	for _, count := range errors {
+		total += count
+	}
+	return total
+}
+
+func (errors ErrorStats) String() string {
+	categories := make([]string, 0, len(errors))
+	for category := range errors {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	items := make([]string, 0, len(categories))
+	for _, category := range categories {
+		items = append(items, fmt.Sprintf("%s=%d", category, errors[category]))
+	}
+	return strings.Join(items, " ")
+}
+
+//adapt Diag to the logger of the elastic client
+type elasticLogger struct {
+	level log.Level
+}
+
+func (logger elasticLogger) Printf(format string, v ...interface{}) {
+	Diag.WithField("component", "elastic").Logf(logger.level, format, v...)
+}
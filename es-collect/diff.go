@@ -0,0 +1,207 @@
+package es_collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	DIFF_NEW      = "new"
+	DIFF_VANISHED = "vanished"
+)
+
+//a full collection of one node written by -save, compared offline by es-pcstat diff
+type CollectionSnapshot struct {
+	Time    time.Time       `json:"time"`
+	Cluster string          `json:"cluster"`
+	Node    string          `json:"node"`
+	Tier    string          `json:"node_tier,omitempty"`
+	Roles   []string        `json:"node_roles,omitempty"`
+	Shards  []ShardSnapshot `json:"shards"`
+}
+
+type ShardSnapshot struct {
+	Index     string         `json:"index"`
+	Uuid      string         `json:"uuid"`
+	Shard     string         `json:"shard"`
+	Primary   bool           `json:"primary"`
+	State     string         `json:"state"`
+	Docs      int64          `json:"docs"`
+	StoreSize int64          `json:"store_size"`
+	Segments  int            `json:"segments"`
+	Files     []FileSnapshot `json:"files"`
+}
+
+type FileSnapshot struct {
+	File   string `json:"file"`
+	Suffix string `json:"suffix"`
+	Size   int64  `json:"size"`
+	Pages  int    `json:"pages"`
+	Cached int    `json:"cached"`
+	//live, unsearchable, committed, merged or new, "" if unknown
+	Segment string `json:"segment,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+	//hard-linked files, owner is the first owner index and links the number of collected shards linking the file.
+	//size, pages and cached are the part attributed to this shard by the hard link policy
+	Owner string `json:"owner,omitempty"`
+	Links int    `json:"links,omitempty"`
+}
+
+//every file of every shard as it is counted in the cycle, the stats must be collected with KEEP_FILE_STATS.
+//a hard-linked file is in every shard linking it with the cache attributed to that shard, so it is summed once
+func (indexStats IndexStats) GetCollectionSnapshot(clusterName string, nodeName string, createdTime time.Time) CollectionSnapshot {
+	node := indexStats.node
+	snapshot := CollectionSnapshot{Time: createdTime, Cluster: clusterName, Node: nodeName, Tier: node.Tier, Roles: node.Roles,
+		Shards: make([]ShardSnapshot, 0, len(indexStats.shards))}
+	for _, shard := range indexStats.shards {
+		files := append(make([]FileSnapshot, 0, len(shard.files)), shard.files...)
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].File < files[j].File
+		})
+		snapshot.Shards = append(snapshot.Shards, ShardSnapshot{Index: shard.indexName, Uuid: shard.uuid, Shard: shard.shardId,
+			Primary: shard.primary, State: shard.state, Docs: shard.store.docs, StoreSize: shard.store.storeSize,
+			Segments: shard.store.segments, Files: files})
+	}
+	sort.Slice(snapshot.Shards, func(i, j int) bool {
+		a, b := snapshot.Shards[i], snapshot.Shards[j]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		if a.Shard != b.Shard {
+			return a.Shard < b.Shard
+		}
+		return a.Primary
+	})
+	return snapshot
+}
+
+func SaveCollectionSnapshot(path string, snapshot CollectionSnapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func LoadCollectionSnapshot(path string) (CollectionSnapshot, error) {
+	snapshot := CollectionSnapshot{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("parse snapshot %q error, %v", path, err)
+	}
+	return snapshot, nil
+}
+
+//cached pages before and after
+type cacheChange struct {
+	name   string
+	before int
+	after  int
+	status string
+}
+
+func (change cacheChange) delta() int {
+	return change.after - change.before
+}
+
+type SnapshotDiff struct {
+	indices  []cacheChange
+	suffixes []cacheChange
+	total    cacheChange
+}
+
+//cached pages by index and by suffix of a snapshot
+func (snapshot CollectionSnapshot) cacheBy() (map[string]int, map[string]int, int) {
+	indices := map[string]int{}
+	suffixes := map[string]int{}
+	total := 0
+	for _, shard := range snapshot.Shards {
+		//an index without cache is still in the snapshot
+		indices[shard.Index] += 0
+		for _, file := range shard.Files {
+			indices[shard.Index] += file.Cached
+			suffixes[file.Suffix] += file.Cached
+			total += file.Cached
+		}
+	}
+	return indices, suffixes, total
+}
+
+//indices only in before are vanished and only in after are new
+func DiffSnapshots(before CollectionSnapshot, after CollectionSnapshot) SnapshotDiff {
+	beforeIndices, beforeSuffixes, beforeTotal := before.cacheBy()
+	afterIndices, afterSuffixes, afterTotal := after.cacheBy()
+	diff := SnapshotDiff{indices: diffCache(beforeIndices, afterIndices, true), suffixes: diffCache(beforeSuffixes, afterSuffixes, false),
+		total: cacheChange{name: "total", before: beforeTotal, after: afterTotal}}
+	return diff
+}
+
+//sorted by the absolute change desc
+func diffCache(before map[string]int, after map[string]int, withStatus bool) []cacheChange {
+	changes := make([]cacheChange, 0)
+	for name, cache := range before {
+		change := cacheChange{name: name, before: cache, after: after[name]}
+		if _, exist := after[name]; !exist && withStatus {
+			change.status = DIFF_VANISHED
+		}
+		changes = append(changes, change)
+	}
+	for name, cache := range after {
+		if _, exist := before[name]; exist {
+			continue
+		}
+		change := cacheChange{name: name, after: cache}
+		if withStatus {
+			change.status = DIFF_NEW
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := math.Abs(float64(changes[i].delta())), math.Abs(float64(changes[j].delta()))
+		if a != b {
+			return a > b
+		}
+		return changes[i].name < changes[j].name
+	})
+	return changes
+}
+
+func pagesToMb(pages int) string {
+	return fmt.Sprintf("%.2f", float64(pages)/float64(FOUR_KB_TO_MB))
+}
+
+func deltaToMb(change cacheChange) string {
+	return fmt.Sprintf("%+.2f", float64(change.delta())/float64(FOUR_KB_TO_MB))
+}
+
+//unchanged indices and suffixes are left out
+func FormatDiffForConsole(before CollectionSnapshot, after CollectionSnapshot, diff SnapshotDiff) {
+	fmt.Printf("before %s %s, after %s %s\n", before.Node, before.Time.Format(time.RFC3339), after.Node, after.Time.Format(time.RFC3339))
+	indexRows := make([][]string, 0)
+	for _, change := range diff.indices {
+		if change.delta() != 0 || change.status != "" {
+			indexRows = append(indexRows, []string{change.name, pagesToMb(change.before), pagesToMb(change.after), deltaToMb(change), change.status})
+		}
+	}
+	printTable([]string{"index", "before_mb", "after_mb", "delta_mb", "status"}, indexRows)
+	suffixRows := make([][]string, 0)
+	for _, change := range diff.suffixes {
+		if change.delta() != 0 {
+			suffixRows = append(suffixRows, []string{change.name, pagesToMb(change.before), pagesToMb(change.after), deltaToMb(change)})
+		}
+	}
+	printTable([]string{"suffix", "before_mb", "after_mb", "delta_mb"}, suffixRows)
+	fmt.Printf("total %s MB -> %s MB, %s MB\n", pagesToMb(diff.total.before), pagesToMb(diff.total.after), deltaToMb(diff.total))
+}
@@ -0,0 +1,72 @@
+package es_collect
+
+import "testing"
+
+func newTestShardSnapshot(index string, files map[string]int) ShardSnapshot {
+	shard := ShardSnapshot{Index: index, Shard: "0", Primary: true}
+	for suffix, cached := range files {
+		shard.Files = append(shard.Files, FileSnapshot{File: "_0." + suffix, Suffix: suffix, Cached: cached})
+	}
+	return shard
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := CollectionSnapshot{Shards: []ShardSnapshot{
+		newTestShardSnapshot("logs", map[string]int{"tim": 512, "doc": 256}),
+		newTestShardSnapshot("old", map[string]int{"fdt": 256}),
+		newTestShardSnapshot("same", map[string]int{"dvd": 100}),
+	}}
+	after := CollectionSnapshot{Shards: []ShardSnapshot{
+		newTestShardSnapshot("logs", map[string]int{"tim": 1024, "doc": 0}),
+		newTestShardSnapshot("same", map[string]int{"dvd": 100}),
+		newTestShardSnapshot("new", map[string]int{"tim": 256}),
+		newTestShardSnapshot("empty", map[string]int{}),
+	}}
+	diff := DiffSnapshots(before, after)
+
+	indices := map[string]cacheChange{}
+	for _, change := range diff.indices {
+		indices[change.name] = change
+	}
+	indexTests := []struct {
+		name   string
+		before int
+		after  int
+		status string
+	}{
+		{"logs", 768, 1024, ""},
+		{"old", 256, 0, DIFF_VANISHED},
+		{"same", 100, 100, ""},
+		{"new", 0, 256, DIFF_NEW},
+		{"empty", 0, 0, DIFF_NEW},
+	}
+	if len(indices) != len(indexTests) {
+		t.Errorf("got %d indices, want %d: %v", len(indices), len(indexTests), diff.indices)
+	}
+	for _, test := range indexTests {
+		change := indices[test.name]
+		if change.before != test.before || change.after != test.after || change.status != test.status {
+			t.Errorf("index %s = %+v, want before %d after %d status %q", test.name, change, test.before, test.after, test.status)
+		}
+	}
+	//sorted by the absolute change
+	if diff.indices[0].name != "logs" {
+		t.Errorf("first index = %s, want logs", diff.indices[0].name)
+	}
+
+	suffixes := map[string]int{}
+	for _, change := range diff.suffixes {
+		if change.status != "" {
+			t.Errorf("suffix %s has status %q", change.name, change.status)
+		}
+		suffixes[change.name] = change.delta()
+	}
+	for suffix, delta := range map[string]int{"tim": 768, "doc": -256, "fdt": -256, "dvd": 0} {
+		if suffixes[suffix] != delta {
+			t.Errorf("delta of suffix %s = %d, want %d", suffix, suffixes[suffix], delta)
+		}
+	}
+	if diff.total.before != 1124 || diff.total.after != 1380 {
+		t.Errorf("total = %+v, want 1124 -> 1380", diff.total)
+	}
+}
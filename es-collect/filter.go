@@ -0,0 +1,125 @@
+package es_collect
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+//patterns with this prefix are regexes, others are globs like logs-*
+var REGEX_PATTERN_PREFIX = "re:"
+
+const INDEX_STATUS_CLOSE = "close"
+
+//match an index name by glob or regex
+type indexMatcher struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+func newIndexMatcher(pattern string) (indexMatcher, error) {
+	if strings.HasPrefix(pattern, REGEX_PATTERN_PREFIX) {
+		regex, err := regexp.Compile(strings.TrimPrefix(pattern, REGEX_PATTERN_PREFIX))
+		if err != nil {
+			return indexMatcher{}, fmt.Errorf("parse index pattern %q error, %v", pattern, err)
+		}
+		return indexMatcher{pattern: pattern, regex: regex}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return indexMatcher{}, fmt.Errorf("parse index pattern %q error, %v", pattern, err)
+	}
+	return indexMatcher{pattern: pattern}, nil
+}
+
+func (matcher indexMatcher) match(indexName string) bool {
+	if matcher.regex != nil {
+		return matcher.regex.MatchString(indexName)
+	}
+	matched, _ := path.Match(matcher.pattern, indexName)
+	return matched
+}
+
+//decide which indices are collected, an index is collected if it matches any include
+//(or include is empty) and no exclude
+type IndexFilter struct {
+	include    []indexMatcher
+	exclude    []indexMatcher
+	skipSystem bool
+	skipClosed bool
+}
+
+//ownIndexName is the pcIndexName of the es output, its daily, rollover and data stream backing indices
+//are excluded unless collectOwn is set
+func NewIndexFilter(include []string, exclude []string, skipSystem bool, skipClosed bool, ownIndexName string, collectOwn bool) (*IndexFilter, error) {
+	filter := &IndexFilter{skipSystem: skipSystem, skipClosed: skipClosed}
+	if !collectOwn && ownIndexName != "" {
+		exclude = append(exclude, ownIndexName+"-*", ".ds-"+ownIndexName+"-*")
+	}
+	for _, pattern := range include {
+		matcher, err := newIndexMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, matcher)
+	}
+	for _, pattern := range exclude {
+		matcher, err := newIndexMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, matcher)
+	}
+	return filter, nil
+}
+
+//prefixes of es.collection.indicesPrefix are includes of prefix*, empty ones are skipped
+func PrefixPatterns(indicesPrefix []string) []string {
+	patterns := make([]string, 0)
+	for _, prefix := range indicesPrefix {
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" {
+			patterns = append(patterns, prefix+"*")
+		}
+	}
+	return patterns
+}
+
+//system and hidden indices start with a dot, like .kibana, .security or .monitoring-es-7-2021.05.01
+func isSystemIndex(indexName string) bool {
+	return strings.HasPrefix(indexName, ".")
+}
+
+func (filter *IndexFilter) Match(index Index) bool {
+	if filter.skipSystem && isSystemIndex(index.indexName) {
+		return false
+	}
+	if filter.skipClosed && index.closed {
+		return false
+	}
+	for _, matcher := range filter.exclude {
+		if matcher.match(index.indexName) {
+			return false
+		}
+	}
+	if len(filter.include) == 0 {
+		return true
+	}
+	for _, matcher := range filter.include {
+		if matcher.match(index.indexName) {
+			return true
+		}
+	}
+	return false
+}
+
+//indices of indexMap that are collected
+func (filter *IndexFilter) Filter(indexMap IndexMap) IndexMap {
+	filtered := IndexMap{}
+	for name, index := range indexMap {
+		if filter.Match(index) {
+			filtered[name] = index
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,246 @@
+package es_collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//dimensions to group indices by, the first one that resolves an index wins, otherwise the group is the index name
+const (
+	GROUP_BY_ALIAS      = "alias"
+	GROUP_BY_DATASTREAM = "datastream"
+	GROUP_BY_PATTERN    = "pattern"
+)
+
+//collapse dated indices like logs-2021.05.01, logs-2021-05-01-000001 or logs_20210501 into logs,
+//the month is after a separator or in a full yyyyMMdd date, so numbers like shard-100012 are kept
+var DEFAULT_GROUP_PATTERN = `^(.+?)[-_.](?:(?:19|20)\d{2}[-_.](?:0[1-9]|1[0-2])(?:[-_.](?:0[1-9]|[12]\d|3[01]))?|(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01]))(?:[-_.]\d+)?$`
+
+type IndexGrouper struct {
+	groupBy []string
+	pattern *regexp.Regexp
+}
+
+//pattern is used by the pattern dimension, the group is its first submatch,
+//or the index name with the match removed if it has no submatch
+func NewIndexGrouper(groupBy []string, pattern string) (*IndexGrouper, error) {
+	grouper := &IndexGrouper{}
+	for _, dimension := range groupBy {
+		dimension = strings.TrimSpace(dimension)
+		switch dimension {
+		case "":
+			continue
+		case GROUP_BY_ALIAS, GROUP_BY_DATASTREAM, GROUP_BY_PATTERN:
+			grouper.groupBy = append(grouper.groupBy, dimension)
+		default:
+			return nil, fmt.Errorf("unknown group dimension %q, choose in [alias, datastream, pattern]", dimension)
+		}
+	}
+	if pattern == "" {
+		pattern = DEFAULT_GROUP_PATTERN
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("parse group pattern error, %v", err)
+	}
+	grouper.pattern = regex
+	return grouper, nil
+}
+
+//group of every index in indexMap, indices without a group are left out
+func (grouper *IndexGrouper) GetIndexGroups(client Client, indexMap IndexMap) map[string]string {
+	groups := map[string]string{}
+	if grouper == nil || len(grouper.groupBy) == 0 {
+		return groups
+	}
+	dimensionGroups := map[string]map[string]string{}
+	for _, dimension := range grouper.groupBy {
+		switch dimension {
+		case GROUP_BY_ALIAS:
+			dimensionGroups[dimension] = getAliasGroups(client)
+		case GROUP_BY_DATASTREAM:
+			dimensionGroups[dimension] = getDataStreamGroups(client)
+		case GROUP_BY_PATTERN:
+			dimensionGroups[dimension] = grouper.getPatternGroups(indexMap)
+		}
+	}
+	for indexName := range indexMap {
+		for _, dimension := range grouper.groupBy {
+			if group, exist := dimensionGroups[dimension][indexName]; exist {
+				groups[indexName] = group
+				break
+			}
+		}
+	}
+	return groups
+}
+
+func (grouper *IndexGrouper) getPatternGroups(indexMap IndexMap) map[string]string {
+	groups := map[string]string{}
+	for indexName := range indexMap {
+		match := grouper.pattern.FindStringSubmatchIndex(indexName)
+		if match == nil {
+			continue
+		}
+		group := ""
+		if len(match) > 2 && match[2] >= 0 {
+			group = indexName[match[2]:match[3]]
+		} else {
+			group = indexName[:match[0]] + indexName[match[1]:]
+		}
+		if group != "" {
+			groups[indexName] = group
+		}
+	}
+	return groups
+}
+
+type catAliasRow struct {
+	Alias string `json:"alias"`
+	Index string `json:"index"`
+}
+
+//an index with many aliases is grouped by the first one in name order
+func getAliasGroups(client Client) map[string]string {
+	groups := map[string]string{}
+	body, err := httpGetRequest(client.getUrl("/_cat/aliases?format=json&h=alias,index"), client.User, client.Password)
+	if err != nil {
+		countError(ERROR_ES_API, "get aliases error, %v", err)
+		return groups
+	}
+	rows := make([]catAliasRow, 0)
+	if err := json.Unmarshal([]byte(body), &rows); err != nil {
+		countError(ERROR_ES_API, "parse aliases error, %v", err)
+		return groups
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Alias < rows[j].Alias
+	})
+	for _, row := range rows {
+		if _, exist := groups[row.Index]; !exist {
+			groups[row.Index] = row.Alias
+		}
+	}
+	return groups
+}
+
+type dataStreamsResponse struct {
+	DataStreams []struct {
+		Name    string `json:"name"`
+		Indices []struct {
+			IndexName string `json:"index_name"`
+		} `json:"indices"`
+	} `json:"data_streams"`
+}
+
+//backing indices of data streams, es before 7.9 has no data stream and answers an error
+func getDataStreamGroups(client Client) map[string]string {
+	groups := map[string]string{}
+	body, err := httpGetRequest(client.getUrl("/_data_stream"), client.User, client.Password)
+	if err != nil {
+		countError(ERROR_ES_API, "get data streams error, %v", err)
+		return groups
+	}
+	response := dataStreamsResponse{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		countError(ERROR_ES_API, "parse data streams error, %v", err)
+		return groups
+	}
+	for _, dataStream := range response.DataStreams {
+		for _, index := range dataStream.Indices {
+			groups[index.IndexName] = dataStream.Name
+		}
+	}
+	return groups
+}
+
+//set the group of every index, it is written with the stats of the index
+func (indexStats IndexStats) WithGroups(groups map[string]string) IndexStats {
+	for indexName, index := range indexStats.indexMap {
+		index.group = groups[indexName]
+		indexStats.indexMap[indexName] = index
+	}
+	return indexStats
+}
+
+//a group row named like an ungrouped index is renamed, the index keeps its own row
+const GROUP_COLLISION_SUFFIX = "[group]"
+
+//stats with the indices of one group merged into one row named by the group,
+//indices without a group keep their own row.
+//every row is built from new maps, the stats are read by the other sinks at the same time
+func (indexStats IndexStats) grouped() IndexStats {
+	ungrouped := map[string]bool{}
+	for _, index := range indexStats.indexMap {
+		if index.group == "" {
+			ungrouped[index.indexName] = true
+		}
+	}
+	indexMap := IndexMap{}
+	for _, index := range indexStats.indexMap {
+		if index.group == "" {
+			row := newRow(index.indexName, "")
+			row.uuid = index.uuid
+			row.closed = index.closed
+			row.creationDate = index.creationDate
+			row.merge(index)
+			indexMap[index.indexName] = row
+			continue
+		}
+		name := index.group
+		if ungrouped[name] {
+			name += GROUP_COLLISION_SUFFIX
+		}
+		merged, exist := indexMap[name]
+		if !exist {
+			merged = newRow(name, index.group)
+		}
+		merged.merge(index)
+		indexMap[name] = merged
+	}
+	indexStats.indexMap = indexMap
+	return indexStats
+}
+
+func newRow(indexName string, group string) Index {
+	return Index{indexName: indexName, group: group, fileSuffixStat: FileSuffixStat{},
+		priStateCache: map[string]int{}, repStateCache: map[string]int{}, priSegmentCache: map[string]int{}, repSegmentCache: map[string]int{},
+		sharedWith: map[string]bool{}}
+}
+
+func (index *Index) merge(other Index) {
+	index.priPageCache += other.priPageCache
+	index.repPageCache += other.repPageCache
+	index.pageCache += other.pageCache
+	index.pages += other.pages
+	index.size += other.size
+	index.shardCount += other.shardCount
+	for _, fileSuffixCache := range other.fileSuffixStat {
+		index.fileSuffixStat.Add(fileSuffixCache.suffixName, fileSuffixCache.priPageCache, true)
+		index.fileSuffixStat.Add(fileSuffixCache.suffixName, fileSuffixCache.repPageCache, false)
+	}
+	for state, cached := range other.priStateCache {
+		index.priStateCache[state] += cached
+	}
+	for state, cached := range other.repStateCache {
+		index.repStateCache[state] += cached
+	}
+	index.priStore.add(other.priStore)
+	index.repStore.add(other.repStore)
+	for state, cached := range other.priSegmentCache {
+		index.priSegmentCache[state] += cached
+	}
+	for state, cached := range other.repSegmentCache {
+		index.repSegmentCache[state] += cached
+	}
+	index.priSharedCache += other.priSharedCache
+	index.repSharedCache += other.repSharedCache
+	for indexName := range other.sharedWith {
+		if indexName != index.indexName {
+			index.sharedWith[indexName] = true
+		}
+	}
+}
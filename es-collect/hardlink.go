@@ -0,0 +1,133 @@
+package es_collect
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+
+	es_pcstat "es-pcstat"
+)
+
+//how the cache of a file hard-linked by many shards is attributed, _shrink, _split and _clone link
+//the segment files of the source index into the new one
+const (
+	HARD_LINK_FIRST = "first" //all to the first owner, the oldest index
+	HARD_LINK_SPLIT = "split" //evenly to every owner
+)
+
+var HARD_LINK_POLICY = HARD_LINK_FIRST
+
+func CheckHardLinkPolicy(policy string) error {
+	if policy != HARD_LINK_FIRST && policy != HARD_LINK_SPLIT {
+		return fmt.Errorf("unknown hard link policy %q, choose in [first, split]", policy)
+	}
+	return nil
+}
+
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
+//one name of a hard-linked file
+type linkedFile struct {
+	shardKey     string
+	name         string
+	suffix       string
+	segmentState string //"" if the segments of the shard are unknown
+}
+
+type linkedInode struct {
+	pcStatus es_pcstat.PcStatus
+	files    []linkedFile
+}
+
+//files with more than one link seen in the cycle, their cache is attributed after every shard is read
+type hardLinks struct {
+	inodes map[inodeKey]*linkedInode
+}
+
+func newHardLinks() *hardLinks {
+	return &hardLinks{inodes: map[inodeKey]*linkedInode{}}
+}
+
+//keep file if it has other links and return true, then its cache is not counted by the shard itself
+func (links *hardLinks) add(file string, pcStatus es_pcstat.PcStatus, linked linkedFile) bool {
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink <= 1 {
+		return false
+	}
+	key := inodeKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+	inode, exist := links.inodes[key]
+	if !exist {
+		inode = &linkedInode{pcStatus: pcStatus}
+		links.inodes[key] = inode
+	}
+	inode.files = append(inode.files, linked)
+	return true
+}
+
+//shards are read in owner order, so the first file of an inode is of the first owner.
+//a file whose other links are out of the collected shards belongs to its only owner
+func (links *hardLinks) attribute(shards map[string]*Shard) {
+	for _, inode := range links.inodes {
+		owners := len(inode.files)
+		for i, linked := range inode.files {
+			shard := shards[linked.shardKey]
+			cached, pages, size := inode.pcStatus.Cached, inode.pcStatus.Pages, inode.pcStatus.Size
+			if HARD_LINK_POLICY == HARD_LINK_SPLIT {
+				cached, pages, size = cached/owners, pages/owners, size/int64(owners)
+				if i == 0 {
+					cached += inode.pcStatus.Cached % owners
+					pages += inode.pcStatus.Pages % owners
+					size += inode.pcStatus.Size % int64(owners)
+				}
+			} else if i > 0 {
+				cached, pages, size = 0, 0, 0
+			}
+			shard.pageCache += cached
+			shard.pages += pages
+			shard.size += size
+			shard.fileSuffixStat.Add(linked.suffix, cached, shard.primary)
+			shard.keepFile(FileSnapshot{File: linked.name, Suffix: linked.suffix, Size: size, Pages: pages, Cached: cached,
+				Segment: linked.segmentState, Owner: shards[inode.files[0].shardKey].indexName, Links: owners})
+			if shard.segmentCache != nil && linked.segmentState != "" {
+				shard.segmentCache[linked.segmentState] += cached
+			}
+			if owners == 1 {
+				continue
+			}
+			shard.sharedCache += cached
+			for _, other := range inode.files {
+				otherIndex := shards[other.shardKey].indexName
+				if otherIndex != shard.indexName {
+					shard.sharedWith[otherIndex] = true
+				}
+			}
+		}
+	}
+}
+
+//oldest index first, it is the source of shrink, split and clone. shards of unknown creation date are last
+func sortShardsByOwner(shardMap ShardMap) []string {
+	keys := make([]string, 0, len(shardMap))
+	for key := range shardMap {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		left, right := shardMap[keys[i]].creationDate, shardMap[keys[j]].creationDate
+		if left != right {
+			if left == 0 || right == 0 {
+				return right == 0
+			}
+			return left < right
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,105 @@
+package es_collect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	es_pcstat "es-pcstat"
+)
+
+func writeTestFile(t *testing.T, file string, size int) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func linkTestFile(t *testing.T, file string, link string) {
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(file, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//source is split into target, _0.tim is linked by both shards, _1.fdt only by source and a file out of the shards
+func TestHardLinkAttribute(t *testing.T) {
+	root, err := ioutil.TempDir("", "hardlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	indicesPath := filepath.Join(root, "indices")
+	source := Shard{indexName: "source", shardId: "0", nodeName: "node-1", uuid: "source-uuid", primary: true,
+		state: SHARD_STATE_STARTED, creationDate: 1}
+	target := Shard{indexName: "target", shardId: "0", nodeName: "node-1", uuid: "target-uuid", primary: true,
+		state: SHARD_STATE_STARTED, creationDate: 2}
+	//3 pages and a size that does not divide by 2, so split leaves a remainder of both
+	shared := filepath.Join(source.getShardPath(indicesPath), "_0.tim")
+	writeTestFile(t, shared, 3*4096-1)
+	linkTestFile(t, shared, filepath.Join(target.getShardPath(indicesPath), "_0.tim"))
+	outside := filepath.Join(source.getShardPath(indicesPath), "_1.fdt")
+	writeTestFile(t, outside, 2*4096)
+	linkTestFile(t, outside, filepath.Join(root, "backup", "_1.fdt"))
+	sharedStatus, err := es_pcstat.GetPcStatus(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsideStatus, err := es_pcstat.GetPcStatus(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shardMap := ShardMap{source.getShardKey(): source, target.getShardKey(): target}
+
+	defer func(policy string) { HARD_LINK_POLICY = policy }(HARD_LINK_POLICY)
+	tests := []struct {
+		policy       string
+		sourcePages  int
+		sourceSize   int64
+		sourceCached int
+		targetPages  int
+		targetSize   int64
+		targetCached int
+	}{
+		{HARD_LINK_FIRST, 3 + 2, 3*4096 - 1 + 2*4096, sharedStatus.Cached + outsideStatus.Cached, 0, 0, 0},
+		{HARD_LINK_SPLIT, 2 + 2, 6144 + 2*4096, sharedStatus.Cached/2 + sharedStatus.Cached%2 + outsideStatus.Cached,
+			1, 6143, sharedStatus.Cached / 2},
+	}
+	for _, test := range tests {
+		HARD_LINK_POLICY = test.policy
+		TakeErrorStats()
+		indexStats := shardMap.Stats(indicesPath)
+		if errors := TakeErrorStats(); errors.total() != 0 {
+			t.Fatalf("%s: errors %s", test.policy, errors)
+		}
+		sourceIndex, targetIndex := indexStats.indexMap["source"], indexStats.indexMap["target"]
+		if sourceIndex.pages != test.sourcePages || sourceIndex.size != test.sourceSize || sourceIndex.pageCache != test.sourceCached {
+			t.Errorf("%s: source pages %d size %d cache %d, want %d %d %d", test.policy, sourceIndex.pages, sourceIndex.size,
+				sourceIndex.pageCache, test.sourcePages, test.sourceSize, test.sourceCached)
+		}
+		if targetIndex.pages != test.targetPages || targetIndex.size != test.targetSize || targetIndex.pageCache != test.targetCached {
+			t.Errorf("%s: target pages %d size %d cache %d, want %d %d %d", test.policy, targetIndex.pages, targetIndex.size,
+				targetIndex.pageCache, test.targetPages, test.targetSize, test.targetCached)
+		}
+		//the linked file is counted once
+		if indexStats.total.pages != 3+2 || indexStats.total.size != 3*4096-1+2*4096 ||
+			indexStats.total.pageCache != sharedStatus.Cached+outsideStatus.Cached {
+			t.Errorf("%s: total pages %d size %d cache %d, want %d %d %d", test.policy, indexStats.total.pages, indexStats.total.size,
+				indexStats.total.pageCache, 3+2, 3*4096-1+2*4096, sharedStatus.Cached+outsideStatus.Cached)
+		}
+		//the file linked out of the collected shards is not shared
+		if sourceIndex.priSharedCache != test.sourceCached-outsideStatus.Cached {
+			t.Errorf("%s: source shared cache %d, want %d", test.policy, sourceIndex.priSharedCache, test.sourceCached-outsideStatus.Cached)
+		}
+		if !reflect.DeepEqual(sourceIndex.sharedWith, map[string]bool{"target": true}) ||
+			!reflect.DeepEqual(targetIndex.sharedWith, map[string]bool{"source": true}) {
+			t.Errorf("%s: source shared with %v, target shared with %v", test.policy, sourceIndex.sharedWith, targetIndex.sharedWith)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package es_collect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gopkg.in/olivere/elastic.v6"
+)
+
+const (
+	OUTPUT_MODE_DAILY      = "daily"
+	OUTPUT_MODE_DATASTREAM = "datastream"
+	OUTPUT_MODE_ROLLOVER   = "rollover"
+)
+
+//rollover condition of the ilm policy, index older or bigger than it rolls over
+var ROLLOVER_MAX_AGE = "1d"
+var ROLLOVER_MAX_SIZE = "10gb"
+
+//data stream needs @timestamp, created is kept for the kibana dashboard
+type lifecycleDoc struct {
+	PageCacheDoc
+	Timestamp time.Time `json:"@timestamp"`
+}
+
+func getPolicyName(indexPrefix string) string {
+	return indexPrefix + "-policy"
+}
+
+//put ilm policy, rollover by age and size, delete KEEP_INDEX_NUM days after rollover
+func putLifecyclePolicy(esClient *elastic.Client, version ClusterVersion, indexPrefix string) error {
+	if version.isOpenSearch() {
+		return putIsmPolicy(esClient, indexPrefix)
+	}
+	policy := map[string]interface{}{
+		"policy": map[string]interface{}{
+			"phases": map[string]interface{}{
+				"hot": map[string]interface{}{
+					"actions": map[string]interface{}{
+						"rollover": map[string]string{"max_age": ROLLOVER_MAX_AGE, "max_size": ROLLOVER_MAX_SIZE},
+					},
+				},
+				"delete": map[string]interface{}{
+					"min_age": strconv.Itoa(KEEP_INDEX_NUM) + "d",
+					"actions": map[string]interface{}{"delete": map[string]interface{}{}},
+				},
+			},
+		},
+	}
+	_, err := esClient.PerformRequest(context.TODO(), elastic.PerformRequestOptions{
+		Method: "PUT",
+		Path:   "/_ilm/policy/" + getPolicyName(indexPrefix),
+		Body:   policy,
+	})
+	if err != nil {
+		return fmt.Errorf("put ilm policy error, policy: %s, %v", getPolicyName(indexPrefix), err)
+	}
+	return nil
+}
+
+//opensearch has ism instead of ilm, the policy is attached to new indices by its ism_template
+func putIsmPolicy(esClient *elastic.Client, indexPrefix string) error {
+	policy := map[string]interface{}{
+		"policy": map[string]interface{}{
+			"description":   "es-pcstat retention",
+			"default_state": "hot",
+			"states": []map[string]interface{}{
+				{
+					"name": "hot",
+					"actions": []map[string]interface{}{
+						{"rollover": map[string]string{"min_index_age": ROLLOVER_MAX_AGE, "min_size": ROLLOVER_MAX_SIZE}},
+					},
+					"transitions": []map[string]interface{}{
+						{"state_name": "delete", "conditions": map[string]string{"min_index_age": strconv.Itoa(KEEP_INDEX_NUM) + "d"}},
+					},
+				},
+				{
+					"name":        "delete",
+					"actions":     []map[string]interface{}{{"delete": map[string]interface{}{}}},
+					"transitions": []map[string]interface{}{},
+				},
+			},
+			"ism_template": []map[string]interface{}{
+				{"index_patterns": []string{indexPrefix + "-*", ".ds-" + indexPrefix + "-*"}, "priority": 200},
+			},
+		},
+	}
+	path := "/_plugins/_ism/policies/" + getPolicyName(indexPrefix)
+	res, err := esClient.PerformRequest(context.TODO(), elastic.PerformRequestOptions{
+		Method:       "GET",
+		Path:         path,
+		IgnoreErrors: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return fmt.Errorf("get ism policy error, policy: %s, %v", getPolicyName(indexPrefix), err)
+	}
+	//ism updates an existing policy only with its sequence number and primary term
+	params := url.Values{}
+	if res.StatusCode == http.StatusOK {
+		current := ismPolicyResponse{}
+		if err := json.Unmarshal(res.Body, &current); err != nil {
+			return fmt.Errorf("parse ism policy error, policy: %s, %v", getPolicyName(indexPrefix), err)
+		}
+		params.Set("if_seq_no", strconv.FormatInt(current.SeqNo, 10))
+		params.Set("if_primary_term", strconv.FormatInt(current.PrimaryTerm, 10))
+	}
+	//a conflict means another agent created or updated the policy in between, it is the same policy
+	_, err = esClient.PerformRequest(context.TODO(), elastic.PerformRequestOptions{
+		Method:       "PUT",
+		Path:         path,
+		Params:       params,
+		Body:         policy,
+		IgnoreErrors: []int{http.StatusConflict},
+	})
+	if err != nil {
+		return fmt.Errorf("put ism policy error, policy: %s, %v", getPolicyName(indexPrefix), err)
+	}
+	return nil
+}
+
+type ismPolicyResponse struct {
+	SeqNo       int64 `json:"_seq_no"`
+	PrimaryTerm int64 `json:"_primary_term"`
+}
+
+//put composable index template, dataStream decides whether the indices back a data stream or a rollover alias
+func putIndexTemplate(esClient *elastic.Client, version ClusterVersion, indexPrefix string, dataStream bool) error {
+	settings := map[string]interface{}{
+		"number_of_replicas": 0,
+	}
+	if !version.isOpenSearch() {
+		settings["index.lifecycle.name"] = getPolicyName(indexPrefix)
+	}
+	pattern := indexPrefix + "-*"
+	if dataStream {
+		pattern = indexPrefix
+	} else if version.isOpenSearch() {
+		settings["index.plugins.index_state_management.rollover_alias"] = indexPrefix
+	} else {
+		settings["index.lifecycle.rollover_alias"] = indexPrefix
+	}
+	mappings := getPcstatMappings(version)
+	properties := map[string]interface{}{"@timestamp": map[string]string{"type": "date"}}
+	for field, property := range pcstatProperties {
+		properties[field] = property
+	}
+	mappings["properties"] = properties
+	template := map[string]interface{}{
+		"index_patterns": []string{pattern},
+		"priority":       200,
+		"template": map[string]interface{}{
+			"settings": settings,
+			"mappings": mappings,
+		},
+	}
+	if dataStream {
+		template["data_stream"] = map[string]interface{}{}
+	}
+	_, err := esClient.PerformRequest(context.TODO(), elastic.PerformRequestOptions{
+		Method: "PUT",
+		Path:   "/_index_template/" + indexPrefix,
+		Body:   template,
+	})
+	if err != nil {
+		return fmt.Errorf("put index template error, template: %s, %v", indexPrefix, err)
+	}
+	return nil
+}
+
+//create the first index of the rollover alias, another agent may have created it already.
+//a concrete index named like the alias, made by an auto-create, blocks the alias and is an error
+func bootstrapRolloverAlias(esClient *elastic.Client, indexPrefix string) error {
+	res, err := esClient.PerformRequest(context.TODO(), elastic.PerformRequestOptions{
+		Method:       "GET",
+		Path:         "/_alias/" + indexPrefix,
+		IgnoreErrors: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return fmt.Errorf("check rollover alias exists error, alias: %s, %v", indexPrefix, err)
+	}
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	exist, err := esClient.IndexExists(indexPrefix).Do(context.TODO())
+	if err != nil {
+		return fmt.Errorf("check index exists error, index_name: %s, %v", indexPrefix, err)
+	}
+	if exist {
+		return fmt.Errorf("index %s is not a rollover alias, delete or reindex it to use rollover mode", indexPrefix)
+	}
+	body := map[string]interface{}{
+		"aliases": map[string]interface{}{
+			indexPrefix: map[string]bool{"is_write_index": true},
+		},
+	}
+	_, err = esClient.PerformRequest(context.TODO(), elastic.PerformRequestOptions{
+		Method: "PUT",
+		Path:   "/" + indexPrefix + "-000001",
+		Body:   body,
+	})
+	if err != nil {
+		if esErr, ok := err.(*elastic.Error); ok && esErr.Details != nil && esErr.Details.Type == "resource_already_exists_exception" {
+			return nil
+		}
+		return fmt.Errorf("create rollover index error, index: %s-000001, %v", indexPrefix, err)
+	}
+	return nil
+}
+
+//install policy and template once, the data stream or alias is the write target of every cycle
+func initPcstatLifecycle(esClient *elastic.Client, version ClusterVersion, indexPrefix string, mode string) error {
+	if !version.supportLifecycle() {
+		return fmt.Errorf("%s output mode needs es 7.9+ or opensearch, the output cluster is %s", mode, version)
+	}
+	if err := putLifecyclePolicy(esClient, version, indexPrefix); err != nil {
+		return err
+	}
+	if err := putIndexTemplate(esClient, version, indexPrefix, mode == OUTPUT_MODE_DATASTREAM); err != nil {
+		return err
+	}
+	if mode == OUTPUT_MODE_ROLLOVER {
+		return bootstrapRolloverAlias(esClient, indexPrefix)
+	}
+	return nil
+}
+
+//write docs to data stream or rollover alias named indexPrefix
+func PostPcstatLifecycleData(esClient *elastic.Client, indexPrefix string, mode string, docs []PageCacheDoc) ([]PageCacheDoc, error) {
+	opType := "index"
+	if mode == OUTPUT_MODE_DATASTREAM {
+		opType = "create"
+	}
+	bulkRequest := esClient.Bulk()
+	for _, doc := range docs {
+		indexReq := elastic.NewBulkIndexRequest().Index(indexPrefix).OpType(opType).Id(doc.id()).Doc(lifecycleDoc{PageCacheDoc: doc, Timestamp: doc.Created})
+		bulkRequest = bulkRequest.Add(indexReq)
+	}
+	return doBulk(bulkRequest, docs)
+}
@@ -0,0 +1,49 @@
+package es_collect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/olivere/elastic.v6"
+)
+
+func TestPutIsmPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		query  string
+	}{
+		{"create", "", ""},
+		{"update", `{"_id":"pcstat-policy","_seq_no":7,"_primary_term":2,"policy":{}}`, "if_primary_term=2&if_seq_no=7"},
+	}
+	for _, test := range tests {
+		puts := make([]string, 0)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if r.Method == "PUT" {
+				puts = append(puts, r.URL.RawQuery)
+				w.Write([]byte(`{}`))
+				return
+			}
+			if test.policy == "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(test.policy))
+		}))
+		client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = putIsmPolicy(client, "pcstat")
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: putIsmPolicy error, %v", test.name, err)
+			continue
+		}
+		if len(puts) != 1 || puts[0] != test.query {
+			t.Errorf("%s: put queries %q, want [%q]", test.name, puts, test.query)
+		}
+	}
+}
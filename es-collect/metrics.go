@@ -0,0 +1,253 @@
+package es_collect
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var DEFAULT_INFLUX_MEASUREMENT = "pcstat"
+var DEFAULT_GRAPHITE_PATH_TEMPLATE = "pcstat.{cluster}.{node}.{index}.{role}.{suffix}"
+
+//error counts of the cycle, by category
+var INFLUX_ERRORS_MEASUREMENT = "pcstat_errors"
+var GRAPHITE_ERRORS_PATH_TEMPLATE = "pcstat.{cluster}.{node}.errors.{category}"
+
+//udp datagrams are kept under the common mtu
+var influxUdpPayloadSize = 1400
+
+//one value of one index, role and file suffix, cache is MB
+type metricPoint struct {
+	clusterName string
+	nodeName    string
+	indexName   string
+	role        string
+	suffix      string
+	tier        string
+	cache       int
+	created     time.Time
+}
+
+func (point metricPoint) placeholders() map[string]string {
+	return map[string]string{
+		"{cluster}": point.clusterName,
+		"{node}":    point.nodeName,
+		"{index}":   point.indexName,
+		"{role}":    point.role,
+		"{suffix}":  point.suffix,
+		"{tier}":    point.tier,
+	}
+}
+
+func getRole(primary bool) string {
+	if primary {
+		return "primary"
+	}
+	return "replica"
+}
+
+func (indexStats IndexStats) getMetricPoints(clusterName string, nodeName string, createdTime time.Time) []metricPoint {
+	docs := indexStats.getStatDocs(clusterName, nodeName, createdTime)
+	points := make([]metricPoint, 0)
+	for _, doc := range docs {
+		suffixes := make([]string, 0, len(doc.Cache))
+		for suffix := range doc.Cache {
+			suffixes = append(suffixes, suffix)
+		}
+		sort.Strings(suffixes)
+		for _, suffix := range suffixes {
+			points = append(points, metricPoint{clusterName: doc.ClusterName, nodeName: doc.NodeName, indexName: doc.IndexName,
+				role: getRole(doc.Primary), suffix: suffix, tier: doc.NodeTier, cache: doc.Cache[suffix], created: doc.Created})
+		}
+	}
+	return points
+}
+
+//one error count of the cycle
+type errorPoint struct {
+	clusterName string
+	nodeName    string
+	category    string
+	count       int
+	created     time.Time
+}
+
+func (indexStats IndexStats) getErrorPoints(clusterName string, nodeName string, createdTime time.Time) []errorPoint {
+	points := make([]errorPoint, 0, len(indexStats.errors))
+	categories := make([]string, 0, len(indexStats.errors))
+	for category := range indexStats.errors {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		points = append(points, errorPoint{clusterName: clusterName, nodeName: nodeName, category: category,
+			count: indexStats.errors[category], created: createdTime})
+	}
+	return points
+}
+
+//replace {cluster} {node} {index} {role} {suffix} {tier} in template, escape is applied to every value
+func expandTemplate(template string, point metricPoint, escape func(string) string) string {
+	result := template
+	for placeholder, value := range point.placeholders() {
+		result = strings.Replace(result, placeholder, escape(value), -1)
+	}
+	return result
+}
+
+//influxdb line protocol, url is http(s)://host:8086/write?db=xxx or udp://host:8089
+type InfluxSink struct {
+	url         string
+	user        string
+	password    string
+	measurement string
+}
+
+func NewInfluxSink(url string, user string, password string, measurement string) *InfluxSink {
+	if measurement == "" {
+		measurement = DEFAULT_INFLUX_MEASUREMENT
+	}
+	return &InfluxSink{url: url, user: user, password: password, measurement: measurement}
+}
+
+func (sink *InfluxSink) Name() string {
+	return "influx"
+}
+
+func (sink *InfluxSink) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error {
+	points := indexStats.getMetricPoints(clusterName, nodeName, createdTime)
+	lines := make([]string, 0, len(points))
+	for _, point := range points {
+		lines = append(lines, sink.formatLine(point))
+	}
+	for _, point := range indexStats.getErrorPoints(clusterName, nodeName, createdTime) {
+		lines = append(lines, fmt.Sprintf("%s,cluster=%s,node=%s,category=%s count=%di %d", INFLUX_ERRORS_MEASUREMENT,
+			escapeInfluxTag(point.clusterName), escapeInfluxTag(point.nodeName), point.category, point.count, point.created.UnixNano()))
+	}
+
+	target, err := url.Parse(sink.url)
+	if err != nil {
+		return fmt.Errorf("parse influx url error, %v", err)
+	}
+	if target.Scheme == "udp" {
+		return writeInfluxUdp(target.Host, lines)
+	}
+	return sink.writeInfluxHttp(lines)
+}
+
+func (sink *InfluxSink) formatLine(point metricPoint) string {
+	measurement := expandTemplate(sink.measurement, point, func(s string) string { return s })
+	measurement = strings.NewReplacer(",", "\\,", " ", "\\ ").Replace(measurement)
+	return fmt.Sprintf("%s,cluster=%s,node=%s,index=%s,role=%s,suffix=%s,tier=%s cache=%di %d",
+		measurement, escapeInfluxTag(point.clusterName), escapeInfluxTag(point.nodeName), escapeInfluxTag(point.indexName),
+		point.role, escapeInfluxTag(point.suffix), escapeInfluxTag(point.tier), point.cache, point.created.UnixNano())
+}
+
+func escapeInfluxTag(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.NewReplacer(",", "\\,", " ", "\\ ", "=", "\\=").Replace(value)
+}
+
+func (sink *InfluxSink) writeInfluxHttp(lines []string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequest("POST", sink.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if sink.user != "" {
+		req.SetBasicAuth(sink.user, sink.password)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("write influx error, %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("write influx error, status %s", resp.Status)
+	}
+	return nil
+}
+
+func writeInfluxUdp(address string, lines []string) error {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return fmt.Errorf("dial influx udp error, %v", err)
+	}
+	defer conn.Close()
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+len(line)+1 > influxUdpPayloadSize {
+			if _, err := conn.Write(buf.Bytes()); err != nil {
+				return fmt.Errorf("write influx udp error, %v", err)
+			}
+			buf.Reset()
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if buf.Len() > 0 {
+		if _, err := conn.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("write influx udp error, %v", err)
+		}
+	}
+	return nil
+}
+
+//graphite plaintext protocol over tcp, address is host:2003
+type GraphiteSink struct {
+	address      string
+	pathTemplate string
+}
+
+func NewGraphiteSink(address string, pathTemplate string) *GraphiteSink {
+	if pathTemplate == "" {
+		pathTemplate = DEFAULT_GRAPHITE_PATH_TEMPLATE
+	}
+	return &GraphiteSink{address: address, pathTemplate: pathTemplate}
+}
+
+func (sink *GraphiteSink) Name() string {
+	return "graphite"
+}
+
+func (sink *GraphiteSink) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error {
+	points := indexStats.getMetricPoints(clusterName, nodeName, createdTime)
+	var buf bytes.Buffer
+	for _, point := range points {
+		path := expandTemplate(sink.pathTemplate, point, escapeGraphiteNode)
+		fmt.Fprintf(&buf, "%s %d %d\n", path, point.cache, point.created.Unix())
+	}
+	for _, point := range indexStats.getErrorPoints(clusterName, nodeName, createdTime) {
+		path := strings.NewReplacer("{cluster}", escapeGraphiteNode(point.clusterName), "{node}", escapeGraphiteNode(point.nodeName),
+			"{category}", point.category).Replace(GRAPHITE_ERRORS_PATH_TEMPLATE)
+		fmt.Fprintf(&buf, "%s %d %d\n", path, point.count, point.created.Unix())
+	}
+
+	conn, err := net.DialTimeout("tcp", sink.address, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("dial graphite error, %v", err)
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write graphite error, %v", err)
+	}
+	return nil
+}
+
+//dots split graphite path, so they can not be in a value
+func escapeGraphiteNode(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.NewReplacer(".", "_", " ", "_", "/", "_").Replace(value)
+}
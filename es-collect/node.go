@@ -0,0 +1,108 @@
+package es_collect
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+//data tier roles of es 7.10+, from the hottest
+var TIER_ROLES = []string{"data_hot", "data_warm", "data_cold", "data_frozen", "data_content"}
+
+const (
+	DATA_ROLE         = "data"
+	DATA_CONTENT_ROLE = "data_content"
+)
+
+//attribute used by hot-warm clusters before data tiers, node.attr.box_type
+var TIER_ATTRIBUTE = "box_type"
+
+//roles and custom attributes of the collected node
+type NodeInfo struct {
+	Id         string
+	Roles      []string
+	Attributes map[string]string
+	//hot, warm, cold, frozen or content, "" if the node has no tier
+	Tier string
+	//pid of the es process, it is only right if the agent shares the pid namespace of es
+	Pid int
+}
+
+type nodesResponse struct {
+	Nodes map[string]struct {
+		Name       string            `json:"name"`
+		Roles      []string          `json:"roles"`
+		Attributes map[string]string `json:"attributes"`
+		Process    struct {
+			Id int `json:"id"`
+		} `json:"process"`
+	} `json:"nodes"`
+}
+
+//get the node by name, or the node es.ip points to if nodeName is ""
+func GetNodeInfo(client Client, nodeName string) NodeInfo {
+	nodeId := "_local"
+	if nodeName != "" {
+		nodeId = url.PathEscape(nodeName)
+	}
+	info := NodeInfo{}
+	body, err := httpGetRequest(client.getUrl("/_nodes/"+nodeId+"?filter_path=nodes.*.name,nodes.*.roles,nodes.*.attributes,nodes.*.process.id"),
+		client.User, client.Password)
+	if err != nil {
+		countError(ERROR_ES_API, "get node info error, %v", err)
+		return info
+	}
+	response := nodesResponse{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		countError(ERROR_ES_API, "parse node info error, %v", err)
+		return info
+	}
+	for nodeId, node := range response.Nodes {
+		info.Id = nodeId
+		info.Roles = node.Roles
+		sort.Strings(info.Roles)
+		info.Attributes = node.Attributes
+		info.Tier = getTier(node.Roles, node.Attributes)
+		info.Pid = node.Process.Id
+		break
+	}
+	return info
+}
+
+//box_type wins over the roles. es 7.10+ nodes have the generic data role and every data_* role unless
+//they are configured, a node with the data role or more than one tier has no specific tier.
+//data_content is kept by hot nodes as well, it is the tier only if the node has no other tier
+func getTier(roles []string, attributes map[string]string) string {
+	if tier, exist := attributes[TIER_ATTRIBUTE]; exist {
+		return tier
+	}
+	tiers := make([]string, 0)
+	for _, tierRole := range TIER_ROLES {
+		for _, role := range roles {
+			if role == DATA_ROLE {
+				return ""
+			}
+			if role == tierRole && role != DATA_CONTENT_ROLE {
+				tiers = append(tiers, strings.TrimPrefix(role, "data_"))
+			}
+		}
+	}
+	if len(tiers) == 1 {
+		return tiers[0]
+	}
+	if len(tiers) == 0 {
+		for _, role := range roles {
+			if role == DATA_CONTENT_ROLE {
+				return strings.TrimPrefix(role, "data_")
+			}
+		}
+	}
+	return ""
+}
+
+//roles and attributes of the node are written in every doc
+func (indexStats IndexStats) WithNode(node NodeInfo) IndexStats {
+	indexStats.node = node
+	return indexStats
+}
@@ -0,0 +1,24 @@
+package es_collect
+
+import "testing"
+
+func TestGetTier(t *testing.T) {
+	tests := []struct {
+		roles      []string
+		attributes map[string]string
+		tier       string
+	}{
+		{[]string{"data", "data_cold", "data_content", "data_frozen", "data_hot", "data_warm", "ingest", "master"}, nil, ""},
+		{[]string{"data_hot", "data_content", "ingest"}, nil, "hot"},
+		{[]string{"data_warm"}, nil, "warm"},
+		{[]string{"data_hot", "data_warm"}, nil, ""},
+		{[]string{"data_content"}, nil, "content"},
+		{[]string{"master"}, nil, ""},
+		{[]string{"data"}, map[string]string{"box_type": "warm"}, "warm"},
+	}
+	for _, test := range tests {
+		if tier := getTier(test.roles, test.attributes); tier != test.tier {
+			t.Errorf("getTier(%v, %v) = %q, want %q", test.roles, test.attributes, tier, test.tier)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package es_collect
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+//index name of the orphan bucket, es index names can not start with "_"
+var ORPHAN_INDEX_NAME = "_orphan"
+
+const SHARD_STATE_ORPHAN = "ORPHAN"
+
+//match every index of the cluster
+var ALL_INDICES = []string{""}
+
+//shard directories under rootPath that no assigned shard of nodeName uses, left by failed relocations,
+//dangling or deleted indices. shardMap and indexMap are all shards and indices of the cluster,
+//they must be got before being filtered. nodeName "" takes a shard on any node as assigned.
+//closed indices have no shards in _cat/shards before es 7.2, their directories are never orphans
+func FindOrphanShards(rootPath string, shardMap ShardMap, indexMap IndexMap, nodeName string) ShardMap {
+	orphans := ShardMap{}
+	//an empty answer of es is taken as an error, or every directory would be orphan
+	if len(shardMap) == 0 || len(indexMap) == 0 {
+		return orphans
+	}
+
+	closedUuids := map[string]string{}
+	for _, index := range indexMap {
+		if index.closed {
+			closedUuids[index.uuid] = index.indexName
+		}
+	}
+	assigned := map[string]bool{}
+	for _, shard := range shardMap {
+		if nodeName != "" && shard.nodeName != nodeName {
+			continue
+		}
+		index, exist := indexMap[shard.indexName]
+		if exist {
+			assigned[index.uuid+"/"+shard.shardId] = true
+		}
+	}
+
+	uuidDirs, err := ioutil.ReadDir(rootPath)
+	if err != nil {
+		countError(ERROR_READDIR, "read dir error, dir : %q , %v", rootPath, err)
+		return orphans
+	}
+	for _, uuidDir := range uuidDirs {
+		if !uuidDir.IsDir() {
+			continue
+		}
+		uuid := uuidDir.Name()
+		if indexName, closed := closedUuids[uuid]; closed {
+			Diag.Debugf("skip shard directories of closed index %q", indexName)
+			continue
+		}
+		shardDirs, err := ioutil.ReadDir(rootPath + "/" + uuid)
+		if err != nil {
+			countError(ERROR_READDIR, "read dir error, dir : %q , %v", rootPath+"/"+uuid, err)
+			continue
+		}
+		for _, shardDir := range shardDirs {
+			//skip _state and other files, shard directories are numbers
+			if _, err := strconv.Atoi(shardDir.Name()); err != nil || !shardDir.IsDir() {
+				continue
+			}
+			shardId := shardDir.Name()
+			if assigned[uuid+"/"+shardId] {
+				continue
+			}
+			orphan := Shard{indexName: ORPHAN_INDEX_NAME, shardId: shardId, nodeName: nodeName, uuid: uuid, state: SHARD_STATE_ORPHAN}
+			if _, err := os.Stat(orphan.getShardPath(rootPath)); err != nil {
+				continue
+			}
+			Diag.Debugf("found orphan shard directory %q", orphan.getShardPath(rootPath))
+			orphans[uuid+"|"+shardId] = orphan
+		}
+	}
+	return orphans
+}
+
+//add shards of other, keys of orphans are uuid|shardId, so they never overwrite an assigned shard
+func (shardMap ShardMap) AddAll(other ShardMap) ShardMap {
+	for key, shard := range other {
+		shardMap[key] = shard
+	}
+	return shardMap
+}
@@ -0,0 +1,186 @@
+package es_collect
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	OTLP_GRPC = "grpc"
+	OTLP_HTTP = "http"
+)
+
+var OTLP_METRIC_NAME = "pcstat.cache"
+var OTLP_ERRORS_METRIC_NAME = "pcstat.errors"
+
+//export cache as otlp gauge, endpoint is host:4317 for grpc or http://host:4318/v1/metrics for http
+type OtlpSink struct {
+	endpoint string
+	protocol string
+	headers  map[string]string
+	conn     *grpc.ClientConn
+}
+
+func NewOtlpSink(endpoint string, protocol string, headers map[string]string) (*OtlpSink, error) {
+	if protocol == "" {
+		protocol = OTLP_GRPC
+	}
+	if protocol != OTLP_GRPC && protocol != OTLP_HTTP {
+		return nil, fmt.Errorf("unknown otlp protocol %q, choose in [grpc, http]", protocol)
+	}
+	return &OtlpSink{endpoint: endpoint, protocol: protocol, headers: headers}, nil
+}
+
+func (sink *OtlpSink) Name() string {
+	return "otlp"
+}
+
+func (sink *OtlpSink) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error {
+	request := indexStats.getOtlpRequest(clusterName, nodeName, createdTime)
+	if sink.protocol == OTLP_HTTP {
+		return sink.exportHttp(request)
+	}
+	return sink.exportGrpc(request)
+}
+
+func (sink *OtlpSink) exportGrpc(request *collectorpb.ExportMetricsServiceRequest) error {
+	if sink.conn == nil {
+		conn, err := grpc.Dial(sink.endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return fmt.Errorf("dial otlp grpc error, %v", err)
+		}
+		sink.conn = conn
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if len(sink.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(sink.headers))
+	}
+	_, err := collectorpb.NewMetricsServiceClient(sink.conn).Export(ctx, request)
+	if err != nil {
+		return fmt.Errorf("export otlp grpc error, %v", err)
+	}
+	return nil
+}
+
+func (sink *OtlpSink) exportHttp(request *collectorpb.ExportMetricsServiceRequest) error {
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", sink.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for key, value := range sink.headers {
+		req.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("export otlp http error, %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("export otlp http error, status %s, %s", resp.Status, respBody)
+	}
+	return nil
+}
+
+func (indexStats IndexStats) getOtlpRequest(clusterName string, nodeName string, createdTime time.Time) *collectorpb.ExportMetricsServiceRequest {
+	hostName, _ := os.Hostname()
+	node := indexStats.node
+	points := indexStats.getMetricPoints(clusterName, nodeName, createdTime)
+	dataPoints := make([]*metricspb.NumberDataPoint, 0, len(points))
+	for _, point := range points {
+		dataPoints = append(dataPoints, &metricspb.NumberDataPoint{
+			Attributes: []*commonpb.KeyValue{
+				otlpAttribute("index", point.indexName),
+				otlpAttribute("role", point.role),
+				otlpAttribute("suffix", point.suffix),
+			},
+			TimeUnixNano: uint64(point.created.UnixNano()),
+			Value:        &metricspb.NumberDataPoint_AsInt{AsInt: int64(point.cache)},
+		})
+	}
+
+	errorDataPoints := make([]*metricspb.NumberDataPoint, 0)
+	for _, point := range indexStats.getErrorPoints(clusterName, nodeName, createdTime) {
+		errorDataPoints = append(errorDataPoints, &metricspb.NumberDataPoint{
+			Attributes:   []*commonpb.KeyValue{otlpAttribute("category", point.category)},
+			TimeUnixNano: uint64(point.created.UnixNano()),
+			Value:        &metricspb.NumberDataPoint_AsInt{AsInt: int64(point.count)},
+		})
+	}
+	metrics := []*metricspb.Metric{{
+		Name:        OTLP_METRIC_NAME,
+		Description: "page cache of elasticsearch index files",
+		Unit:        "MiBy",
+		Data:        &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: dataPoints}},
+	}}
+	if len(errorDataPoints) > 0 {
+		metrics = append(metrics, &metricspb.Metric{
+			Name:        OTLP_ERRORS_METRIC_NAME,
+			Description: "errors of the collect cycle by category",
+			Unit:        "{error}",
+			Data:        &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: errorDataPoints}},
+		})
+	}
+
+	return &collectorpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: getOtlpResourceAttributes(clusterName, nodeName, hostName, node)},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: "es-pcstat"},
+				Metrics: metrics,
+			}},
+		}},
+	}
+}
+
+//node attributes are es.node.attr.<name>, like es.node.attr.box_type
+func getOtlpResourceAttributes(clusterName string, nodeName string, hostName string, node NodeInfo) []*commonpb.KeyValue {
+	attributes := []*commonpb.KeyValue{
+		otlpAttribute("service.name", "es-pcstat"),
+		otlpAttribute("es.cluster.name", clusterName),
+		otlpAttribute("es.node.name", nodeName),
+		otlpAttribute("host.name", hostName),
+	}
+	if node.Tier != "" {
+		attributes = append(attributes, otlpAttribute("es.node.tier", node.Tier))
+	}
+	if len(node.Roles) > 0 {
+		attributes = append(attributes, otlpAttribute("es.node.roles", strings.Join(node.Roles, ",")))
+	}
+	names := make([]string, 0, len(node.Attributes))
+	for name := range node.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attributes = append(attributes, otlpAttribute("es.node.attr."+name, node.Attributes[name]))
+	}
+	return attributes
+}
+
+func otlpAttribute(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
@@ -0,0 +1,137 @@
+package es_collect
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+//one index with 2 MB of tim on the primary, on a hot node
+func newOtlpTestStats() IndexStats {
+	index := Index{indexName: "logs", priPageCache: 2 * FOUR_KB_TO_MB, pageCache: 2 * FOUR_KB_TO_MB, fileSuffixStat: FileSuffixStat{}}
+	index.fileSuffixStat.Add("tim", 2*FOUR_KB_TO_MB, true)
+	total := Index{indexName: "total", fileSuffixStat: FileSuffixStat{}}
+	return IndexStats{indexMap: IndexMap{"logs": index}, total: total}.
+		WithNode(NodeInfo{Roles: []string{"data_hot"}, Attributes: map[string]string{"box_type": "hot"}, Tier: "hot"})
+}
+
+func getOtlpAttributes(attributes []*commonpb.KeyValue) map[string]string {
+	values := map[string]string{}
+	for _, attribute := range attributes {
+		values[attribute.Key] = attribute.Value.GetStringValue()
+	}
+	return values
+}
+
+//the request as a collector receives it, with the resource attributes and the point of logs primary tim
+func checkOtlpRequest(t *testing.T, request *collectorpb.ExportMetricsServiceRequest) {
+	if len(request.ResourceMetrics) != 1 {
+		t.Fatalf("got %d resource metrics, want 1", len(request.ResourceMetrics))
+	}
+	hostName, _ := os.Hostname()
+	resource := getOtlpAttributes(request.ResourceMetrics[0].Resource.Attributes)
+	for key, want := range map[string]string{"es.cluster.name": "es_local", "es.node.name": "node1", "host.name": hostName,
+		"es.node.tier": "hot", "es.node.attr.box_type": "hot"} {
+		if resource[key] != want {
+			t.Errorf("resource attribute %s = %q, want %q", key, resource[key], want)
+		}
+	}
+
+	found := false
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if metric.Name != OTLP_METRIC_NAME {
+			continue
+		}
+		for _, point := range metric.GetGauge().DataPoints {
+			attributes := getOtlpAttributes(point.Attributes)
+			if attributes["index"] == "logs" && attributes["role"] == "primary" && attributes["suffix"] == "tim" {
+				found = true
+				if point.GetAsInt() != 2 {
+					t.Errorf("cache of logs primary tim = %d, want 2", point.GetAsInt())
+				}
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no point with index logs, role primary and suffix tim in %v", request)
+	}
+}
+
+func TestOtlpHttpExport(t *testing.T) {
+	requests := make(chan *collectorpb.ExportMetricsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		request := &collectorpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("decode request error, %v", err)
+		}
+		requests <- request
+	}))
+	defer server.Close()
+
+	sink, err := NewOtlpSink(server.URL+"/v1/metrics", OTLP_HTTP, map[string]string{"Authorization": "Bearer token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(newOtlpTestStats(), "es_local", "node1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	checkOtlpRequest(t, <-requests)
+}
+
+//grpc collector stand-in keeping the exported requests
+type testMetricsServer struct {
+	collectorpb.UnimplementedMetricsServiceServer
+	requests chan *collectorpb.ExportMetricsServiceRequest
+	headers  chan metadata.MD
+}
+
+func (server *testMetricsServer) Export(ctx context.Context, request *collectorpb.ExportMetricsServiceRequest) (*collectorpb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	server.headers <- md
+	server.requests <- request
+	return &collectorpb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOtlpGrpcExport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metricsServer := &testMetricsServer{requests: make(chan *collectorpb.ExportMetricsServiceRequest, 1), headers: make(chan metadata.MD, 1)}
+	grpcServer := grpc.NewServer()
+	collectorpb.RegisterMetricsServiceServer(grpcServer, metricsServer)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	sink, err := NewOtlpSink(listener.Addr().String(), OTLP_GRPC, map[string]string{"authorization": "Bearer token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if sink.conn != nil {
+			sink.conn.Close()
+		}
+	}()
+	if err := sink.Write(newOtlpTestStats(), "es_local", "node1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if md := <-metricsServer.headers; len(md.Get("authorization")) != 1 || md.Get("authorization")[0] != "Bearer token" {
+		t.Errorf("metadata = %v, want the authorization header", md)
+	}
+	checkOtlpRequest(t, <-metricsServer.requests)
+}
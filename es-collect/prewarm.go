@@ -0,0 +1,162 @@
+package es_collect
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	es_pcstat "es-pcstat"
+)
+
+//files are advised in chunks, so the rate limit is kept all along a big file
+var ADVISE_CHUNK_SIZE int64 = 4 * 1024 * 1024
+
+//files of every shard under rootPath, only the given suffixes if any
+func (shardMap ShardMap) GetShardFiles(rootPath string, suffixes []string) []string {
+	suffixSet := map[string]bool{}
+	for _, suffix := range suffixes {
+		suffixSet[suffix] = true
+	}
+	files := make([]string, 0)
+	for _, shard := range shardMap {
+		for _, file := range getFiles(shard.getShardPath(rootPath)) {
+			if len(suffixSet) == 0 || suffixSet[getFileSuffix(file)] {
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+//shards of the given shard ids, all shards if none
+func (shardMap ShardMap) FilterShardIds(shardIds []string) ShardMap {
+	if len(shardIds) == 0 {
+		return shardMap
+	}
+	shardIdSet := map[string]bool{}
+	for _, shardId := range shardIds {
+		shardIdSet[shardId] = true
+	}
+	filtered := make(ShardMap)
+	for key, shard := range shardMap {
+		if shardIdSet[shard.shardId] {
+			filtered[key] = shard
+		}
+	}
+	return filtered
+}
+
+//cached and total pages of files
+func GetResidency(files []string) (int, int) {
+	cached, pages := 0, 0
+	for _, file := range files {
+		pcStatus, err := es_pcstat.GetPcStatus(file)
+		if err != nil {
+			countError(ERROR_MMAP, "skipping %q: %v", file, err)
+			continue
+		}
+		cached += pcStatus.Cached
+		pages += pcStatus.Pages
+	}
+	return cached, pages
+}
+
+func residencyPercent(cached int, pages int) float64 {
+	if pages == 0 {
+		return 0
+	}
+	return float64(cached) / float64(pages) * 100
+}
+
+//a byte range of a file
+type fileRange struct {
+	offset int64
+	length int64
+}
+
+//posix_fadvise every file chunk by chunk, rate is MB per second and 0 is unlimited.
+//progress is printed every interval with the residency of the files from mincore
+func AdviseFiles(name string, files []string, advice int, rate int, interval time.Duration) error {
+	return adviseFileRanges(name, files, nil, advice, rate, interval)
+}
+
+//only the ranges of a file are advised, the whole file if it has no ranges
+func adviseFileRanges(name string, files []string, ranges map[string][]fileRange, advice int, rate int, interval time.Duration) error {
+	var total int64
+	for _, file := range files {
+		if fileRanges, exist := ranges[file]; exist {
+			for _, r := range fileRanges {
+				total += r.length
+			}
+		} else if info, err := os.Stat(file); err == nil {
+			total += info.Size()
+		}
+	}
+	cached, pages := GetResidency(files)
+	fmt.Printf("%s %d files, %d MB, resident %d MB %.2f%%\n", name, len(files), total/1024/1024,
+		cached/FOUR_KB_TO_MB, residencyPercent(cached, pages))
+
+	start := time.Now()
+	lastProgress := start
+	var advised int64
+	//pages of files still cached after DONTNEED, es maps them or they are dirty
+	kept := make([]es_pcstat.PcStatus, 0)
+	for i, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			countError(ERROR_MMAP, "skipping %q: %v", file, err)
+			continue
+		}
+		fileRanges, exist := ranges[file]
+		if !exist {
+			info, err := f.Stat()
+			if err != nil {
+				f.Close()
+				countError(ERROR_MMAP, "skipping %q: %v", file, err)
+				continue
+			}
+			fileRanges = []fileRange{{0, info.Size()}}
+		}
+		for _, r := range fileRanges {
+			for offset := r.offset; offset < r.offset+r.length; offset += ADVISE_CHUNK_SIZE {
+				length := ADVISE_CHUNK_SIZE
+				if offset+length > r.offset+r.length {
+					length = r.offset + r.length - offset
+				}
+				if err := es_pcstat.FileAdvise(f, offset, length, advice); err != nil {
+					f.Close()
+					return fmt.Errorf("fadvise %q error, %v", file, err)
+				}
+				advised += length
+				//sleep until the advised bytes are within the rate
+				if rate > 0 {
+					expected := time.Duration(float64(advised) / float64(rate*1024*1024) * float64(time.Second))
+					if elapsed := time.Since(start); expected > elapsed {
+						time.Sleep(expected - elapsed)
+					}
+				}
+				if interval > 0 && time.Since(lastProgress) >= interval {
+					cached, pages := GetResidency(files)
+					fmt.Printf("%s %d/%d files, %d/%d MB advised, resident %.2f%%\n", name, i, len(files),
+						advised/1024/1024, total/1024/1024, residencyPercent(cached, pages))
+					lastProgress = time.Now()
+				}
+			}
+		}
+		f.Close()
+		if advice == es_pcstat.FADV_DONTNEED {
+			if pcStatus, err := es_pcstat.GetPcStatus(file); err == nil && pcStatus.Cached > 0 {
+				kept = append(kept, pcStatus)
+			}
+		}
+	}
+
+	cached, pages = GetResidency(files)
+	fmt.Printf("%s done in %s, %d MB advised, resident %d MB %.2f%%\n", name, time.Since(start).Round(time.Millisecond),
+		advised/1024/1024, cached/FOUR_KB_TO_MB, residencyPercent(cached, pages))
+	for _, pcStatus := range kept {
+		fmt.Printf("%s kept %s, resident %d KB %.2f%%, mmapped by es or dirty\n", name, pcStatus.Name, pcStatus.Cached*4,
+			residencyPercent(pcStatus.Cached, pcStatus.Pages))
+	}
+	return nil
+}
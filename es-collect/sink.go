@@ -0,0 +1,268 @@
+package es_collect
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/olivere/elastic.v6"
+)
+
+//cycles a sink may fall behind before new cycles are dropped for it
+var SINK_QUEUE_SIZE = 2
+
+//console, csv and jsonl sinks write a whole cycle under the lock, so their lines never interleave on stdout
+var stdoutLock sync.Mutex
+
+//sink is one output of the collected stats, like console, log or es
+type Sink interface {
+	Name() string
+	Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error
+}
+
+type sinkTask struct {
+	indexStats  IndexStats
+	clusterName string
+	nodeName    string
+	createdTime time.Time
+}
+
+//run every sink in its own goroutine, a slow or failing sink does not block the others
+type SinkGroup struct {
+	sinks  []Sink
+	queues []chan sinkTask
+}
+
+func StartSinks(sinks []Sink) *SinkGroup {
+	group := &SinkGroup{sinks: sinks, queues: make([]chan sinkTask, len(sinks))}
+	for i, sink := range sinks {
+		queue := make(chan sinkTask, SINK_QUEUE_SIZE)
+		group.queues[i] = queue
+		go runSink(sink, queue)
+	}
+	return group
+}
+
+//error of a sink with its error category, errors without one are counted as output errors
+type outputError struct {
+	category string
+	err      error
+}
+
+func (e outputError) Error() string {
+	return e.err.Error()
+}
+
+func (e outputError) Unwrap() error {
+	return e.err
+}
+
+func runSink(sink Sink, queue chan sinkTask) {
+	for task := range queue {
+		err := sink.Write(task.indexStats, task.clusterName, task.nodeName, task.createdTime)
+		if err != nil {
+			category := ERROR_OUTPUT
+			var categorized outputError
+			if errors.As(err, &categorized) {
+				category = categorized.category
+			}
+			countError(category, "output %s error, %v", sink.Name(), err)
+		}
+	}
+}
+
+func (group *SinkGroup) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) {
+	task := sinkTask{indexStats: indexStats, clusterName: clusterName, nodeName: nodeName, createdTime: createdTime}
+	for i, queue := range group.queues {
+		select {
+		case queue <- task:
+		default:
+			Diag.Warnf("output %s is busy, skip collect of %s", group.sinks[i].Name(), createdTime)
+		}
+	}
+}
+
+type ConsoleSink struct {
+	sortByCache bool
+	columns     []string
+	lastStats   *IndexStats
+}
+
+func NewConsoleSink(sortByCache bool, columns []string) *ConsoleSink {
+	return &ConsoleSink{sortByCache: sortByCache, columns: columns}
+}
+
+func (sink *ConsoleSink) Name() string {
+	return "console"
+}
+
+//indices of one group are printed as one row
+func (sink *ConsoleSink) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error {
+	indexStats = indexStats.grouped()
+	stdoutLock.Lock()
+	defer stdoutLock.Unlock()
+	indexStats.FormatForConsole(sink.sortByCache, sink.columns, sink.lastStats)
+	sink.lastStats = &indexStats
+	return nil
+}
+
+type LogSink struct {
+	logger *log.Logger
+}
+
+/* 日志轮转相关函数
+`WithLinkName` 为最新的日志建立软连接
+`WithRotationTime` 设置日志分割的时间，隔多久分割一次
+WithMaxAge 和 WithRotationCount二者只能设置一个
+ `WithMaxAge` 设置文件清理前的最长保存时间
+ `WithRotationCount` 设置文件清理前最多保存的个数
+*/
+func NewLogSink(path string, keepLogNum int) (*LogSink, error) {
+	writer, err := rotatelogs.New(
+		path+".%Y%m%d",
+		rotatelogs.WithLinkName(path),
+		rotatelogs.WithMaxAge(time.Duration(24*keepLogNum)*time.Hour),
+		rotatelogs.WithRotationTime(time.Duration(24)*time.Hour),
+	)
+	if err != nil {
+		return nil, err
+	}
+	logger := log.New()
+	logger.SetOutput(writer)
+	logger.SetFormatter(&log.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05"})
+	return &LogSink{logger: logger}, nil
+}
+
+func (sink *LogSink) Name() string {
+	return "log"
+}
+
+func (sink *LogSink) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error {
+	indexStats.FormatForSLS(sink.logger, clusterName, nodeName, createdTime)
+	return nil
+}
+
+//the es client is created on first write, so the agent starts even if the output cluster is down
+//mode is daily, datastream or rollover, see lifecycle.go
+//failed docs are saved to spool if it is set, and replayed after a later write succeeds.
+//docs have a fixed id, so replaying docs already written by a timed out request does not duplicate them
+type EsSink struct {
+	scheme   string
+	ip       string
+	port     string
+	user     string
+	password string
+	mode     string
+	client   *elastic.Client
+	version  ClusterVersion
+	spool    *Spool
+
+	lifecycleReady bool
+}
+
+func NewEsSink(scheme string, ip string, port string, user string, password string, mode string, spool *Spool) (*EsSink, error) {
+	if mode == "" {
+		mode = OUTPUT_MODE_DAILY
+	}
+	if mode != OUTPUT_MODE_DAILY && mode != OUTPUT_MODE_DATASTREAM && mode != OUTPUT_MODE_ROLLOVER {
+		return nil, fmt.Errorf("unknown es output mode %q, choose in [daily, datastream, rollover]", mode)
+	}
+	return &EsSink{scheme: scheme, ip: ip, port: port, user: user, password: password, mode: mode, spool: spool}, nil
+}
+
+func (sink *EsSink) Name() string {
+	return "es"
+}
+
+func (sink *EsSink) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error {
+	docs := indexStats.getStatDocs(clusterName, nodeName, createdTime)
+	failed, err := sink.post(docs)
+	if err != nil {
+		if sink.spool != nil {
+			if spoolErr := sink.spool.Save(failed); spoolErr != nil {
+				return fmt.Errorf("%w, and save to spool error, %v", err, spoolErr)
+			}
+			return fmt.Errorf("%w, saved to spool", err)
+		}
+		return err
+	}
+
+	if sink.spool != nil {
+		replayed, err := sink.spool.Replay(sink.replay)
+		if replayed > 0 {
+			Diag.Infof("replayed %d spooled batches to es", replayed)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//daily indices out of keepIndexNum are already deleted, their batches are dropped
+func (sink *EsSink) replay(docs []PageCacheDoc) error {
+	if sink.mode == OUTPUT_MODE_DAILY && len(docs) > 0 && isExpired(docs[0].Created, time.Now()) {
+		Diag.Warnf("drop spooled batch of %s, out of keepIndexNum", docs[0].Created)
+		return nil
+	}
+	_, err := sink.post(docs)
+	return err
+}
+
+//the failed docs are returned
+func (sink *EsSink) post(docs []PageCacheDoc) ([]PageCacheDoc, error) {
+	if sink.client == nil {
+		client, err := OutputClient(sink.scheme, sink.ip, sink.port, sink.user, sink.password)
+		if err != nil {
+			return docs, outputError{category: ERROR_ES_API, err: fmt.Errorf("create es client error, %v", err)}
+		}
+		//the request format depends on the version, detect it before the first write
+		version, err := getClusterVersion(client)
+		if err != nil {
+			client.Stop()
+			return docs, outputError{category: ERROR_ES_API, err: err}
+		}
+		Diag.Infof("output cluster version, %s", version)
+		sink.client = client
+		sink.version = version
+	}
+	if sink.mode == OUTPUT_MODE_DAILY {
+		return PostPcstatData(sink.client, sink.version, docs)
+	}
+	if !sink.lifecycleReady {
+		if err := initPcstatLifecycle(sink.client, sink.version, PCSTAT_INDEX_NAME, sink.mode); err != nil {
+			return docs, outputError{category: ERROR_ES_API, err: err}
+		}
+		sink.lifecycleReady = true
+	}
+	return PostPcstatLifecycleData(sink.client, PCSTAT_INDEX_NAME, sink.mode, docs)
+}
+
+type CsvSink struct{}
+
+func (sink CsvSink) Name() string {
+	return "csv"
+}
+
+func (sink CsvSink) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error {
+	stdoutLock.Lock()
+	defer stdoutLock.Unlock()
+	indexStats.FormatForCsv(clusterName, nodeName, createdTime)
+	return nil
+}
+
+type JsonLinesSink struct{}
+
+func (sink JsonLinesSink) Name() string {
+	return "jsonl"
+}
+
+func (sink JsonLinesSink) Write(indexStats IndexStats, clusterName string, nodeName string, createdTime time.Time) error {
+	stdoutLock.Lock()
+	defer stdoutLock.Unlock()
+	indexStats.FormatForJsonLines(clusterName, nodeName, createdTime)
+	return nil
+}
@@ -0,0 +1,141 @@
+package es_collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	es_pcstat "es-pcstat"
+)
+
+//cached pages of a file, files are keyed by index uuid, shard, file name and size like vmtouch or pgfincore
+type FileResidency struct {
+	Uuid  string `json:"uuid"`
+	Shard string `json:"shard"`
+	File  string `json:"file"`
+	Size  int64  `json:"size"`
+	//[first page, page count] of every cached range
+	Ranges [][2]int `json:"ranges"`
+}
+
+type ResidencySnapshot struct {
+	Time     time.Time       `json:"time"`
+	Node     string          `json:"node"`
+	PageSize int             `json:"page_size"`
+	Files    []FileResidency `json:"files"`
+}
+
+//ranges of the cached pages
+func encodeRanges(ppStat []bool) [][2]int {
+	ranges := make([][2]int, 0)
+	for i := 0; i < len(ppStat); i++ {
+		if !ppStat[i] {
+			continue
+		}
+		start := i
+		for i < len(ppStat) && ppStat[i] {
+			i++
+		}
+		ranges = append(ranges, [2]int{start, i - start})
+	}
+	return ranges
+}
+
+//residency of the shard files under rootPath, files without cached pages are left out
+func (shardMap ShardMap) GetResidencySnapshot(rootPath string, nodeName string) ResidencySnapshot {
+	snapshot := ResidencySnapshot{Time: time.Now(), Node: nodeName, PageSize: os.Getpagesize(), Files: make([]FileResidency, 0)}
+	for _, shard := range shardMap {
+		for _, file := range getFiles(shard.getShardPath(rootPath)) {
+			pcStatus, err := es_pcstat.GetPcStatus(file)
+			if err != nil {
+				countError(ERROR_MMAP, "skipping %q: %v", file, err)
+				continue
+			}
+			if pcStatus.Cached == 0 {
+				continue
+			}
+			snapshot.Files = append(snapshot.Files, FileResidency{Uuid: shard.uuid, Shard: shard.shardId,
+				File: filepath.Base(file), Size: pcStatus.Size, Ranges: encodeRanges(pcStatus.PPStat)})
+		}
+	}
+	sort.Slice(snapshot.Files, func(i, j int) bool {
+		a, b := snapshot.Files[i], snapshot.Files[j]
+		if a.Uuid != b.Uuid {
+			return a.Uuid < b.Uuid
+		}
+		if a.Shard != b.Shard {
+			return a.Shard < b.Shard
+		}
+		return a.File < b.File
+	})
+	return snapshot
+}
+
+//written to a temp file and renamed, a crash never leaves a broken snapshot
+func SaveResidencySnapshot(path string, snapshot ResidencySnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func LoadResidencySnapshot(path string) (ResidencySnapshot, error) {
+	snapshot := ResidencySnapshot{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("parse snapshot %q error, %v", path, err)
+	}
+	return snapshot, nil
+}
+
+//read the cached ranges of the snapshot into the page cache again, like after a restart
+func RestoreResidency(rootPath string, snapshot ResidencySnapshot, rate int, interval time.Duration) error {
+	files, ranges, skipped := getRestoreRanges(rootPath, snapshot)
+	fmt.Printf("restore snapshot of %s taken at %s, %d files, %d skipped\n", snapshot.Node,
+		snapshot.Time.Format(time.RFC3339), len(snapshot.Files), skipped)
+	return adviseFileRanges("restore", files, ranges, es_pcstat.FADV_WILLNEED, rate, interval)
+}
+
+//byte ranges of the snapshot files under rootPath, files missing or of another size are skipped,
+//they are merged away or changed since the snapshot
+func getRestoreRanges(rootPath string, snapshot ResidencySnapshot) ([]string, map[string][]fileRange, int) {
+	files := make([]string, 0)
+	ranges := map[string][]fileRange{}
+	pageSize := int64(snapshot.PageSize)
+	skipped := 0
+	for _, fileResidency := range snapshot.Files {
+		file := rootPath + "/" + fileResidency.Uuid + "/" + fileResidency.Shard + "/index/" + fileResidency.File
+		info, err := os.Stat(file)
+		if err != nil || info.Size() != fileResidency.Size {
+			Diag.Debugf("restore skipping %q, it is changed or gone since the snapshot", file)
+			skipped++
+			continue
+		}
+		fileRanges := make([]fileRange, 0, len(fileResidency.Ranges))
+		for _, r := range fileResidency.Ranges {
+			offset, length := int64(r[0])*pageSize, int64(r[1])*pageSize
+			if offset >= info.Size() {
+				continue
+			}
+			if offset+length > info.Size() {
+				length = info.Size() - offset
+			}
+			fileRanges = append(fileRanges, fileRange{offset, length})
+		}
+		files = append(files, file)
+		ranges[file] = fileRanges
+	}
+	return files, ranges, skipped
+}
@@ -0,0 +1,84 @@
+package es_collect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	es_pcstat "es-pcstat"
+)
+
+func TestEncodeRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		ppStat []bool
+		ranges [][2]int
+	}{
+		{"empty", []bool{}, [][2]int{}},
+		{"none cached", []bool{false, false, false}, [][2]int{}},
+		{"all cached", []bool{true, true, true, true}, [][2]int{{0, 4}}},
+		{"alternating", []bool{true, false, true, false, true}, [][2]int{{0, 1}, {2, 1}, {4, 1}}},
+		{"trailing run", []bool{false, false, true, true, true}, [][2]int{{2, 3}}},
+		{"leading and trailing", []bool{true, true, false, false, true}, [][2]int{{0, 2}, {4, 1}}},
+	}
+	for _, test := range tests {
+		if ranges := encodeRanges(test.ppStat); !reflect.DeepEqual(ranges, test.ranges) {
+			t.Errorf("%s: encodeRanges(%v) = %v, want %v", test.name, test.ppStat, ranges, test.ranges)
+		}
+	}
+
+	//the truncated last page of a file is a page of its own
+	root, err := ioutil.TempDir("", "ranges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	file := filepath.Join(root, "_0.tim")
+	writeTestFile(t, file, 2*4096+10)
+	pcStatus, err := es_pcstat.GetPcStatus(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcStatus.Pages != 3 {
+		t.Fatalf("pages of %d bytes = %d, want 3", pcStatus.Size, pcStatus.Pages)
+	}
+	cached := 0
+	for _, r := range encodeRanges(pcStatus.PPStat) {
+		if r[0]+r[1] > pcStatus.Pages {
+			t.Errorf("range %v is out of %d pages", r, pcStatus.Pages)
+		}
+		cached += r[1]
+	}
+	if cached != pcStatus.Cached {
+		t.Errorf("ranges cover %d pages, want %d cached", cached, pcStatus.Cached)
+	}
+}
+
+func TestGetRestoreRanges(t *testing.T) {
+	root, err := ioutil.TempDir("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	shardPath := filepath.Join(root, "uuid", "0", "index")
+	//_0.tim is unchanged, its last page is truncated, _1.fdt is rewritten with another size and _2.doc is gone
+	writeTestFile(t, filepath.Join(shardPath, "_0.tim"), 3*4096-100)
+	writeTestFile(t, filepath.Join(shardPath, "_1.fdt"), 4096)
+	snapshot := ResidencySnapshot{PageSize: 4096, Files: []FileResidency{
+		{Uuid: "uuid", Shard: "0", File: "_0.tim", Size: 3*4096 - 100, Ranges: [][2]int{{0, 1}, {2, 1}, {5, 1}}},
+		{Uuid: "uuid", Shard: "0", File: "_1.fdt", Size: 2 * 4096, Ranges: [][2]int{{0, 2}}},
+		{Uuid: "uuid", Shard: "0", File: "_2.doc", Size: 4096, Ranges: [][2]int{{0, 1}}},
+	}}
+	files, ranges, skipped := getRestoreRanges(root, snapshot)
+	restored := root + "/uuid/0/index/_0.tim"
+	if skipped != 2 || !reflect.DeepEqual(files, []string{restored}) {
+		t.Fatalf("getRestoreRanges files %v, skipped %d, want [%s], 2 skipped", files, skipped, restored)
+	}
+	//the range out of the file is dropped and the last one ends at the file size
+	want := []fileRange{{0, 4096}, {2 * 4096, 4096 - 100}}
+	if !reflect.DeepEqual(ranges[restored], want) {
+		t.Errorf("ranges of %s = %v, want %v", restored, ranges[restored], want)
+	}
+}
@@ -0,0 +1,118 @@
+package es_collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var SPOOL_MIN_BACKOFF = 30 * time.Second
+var SPOOL_MAX_BACKOFF = 30 * time.Minute
+
+//bounded on-disk queue of bulk batches the es output failed to write
+//every batch is one file named by its unix nano time, the oldest batch is dropped when maxBatches is exceeded
+type Spool struct {
+	dir        string
+	maxBatches int
+
+	backoff    time.Duration
+	nextReplay time.Time
+}
+
+func NewSpool(dir string, maxBatches int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create spool dir error, dir: %s, %v", dir, err)
+	}
+	return &Spool{dir: dir, maxBatches: maxBatches}, nil
+}
+
+func (spool *Spool) Save(docs []PageCacheDoc) error {
+	body, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(spool.dir, fmt.Sprintf("%019d.json", time.Now().UnixNano()))
+	//write to tmp file and rename, a half written batch is never replayed
+	if err := ioutil.WriteFile(name+".tmp", body, 0644); err != nil {
+		return fmt.Errorf("write spool error, file: %s, %v", name, err)
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return fmt.Errorf("write spool error, file: %s, %v", name, err)
+	}
+
+	batches := spool.batches()
+	for len(batches) > spool.maxBatches {
+		Diag.Warnf("spool is full, drop batch %s", batches[0])
+		os.Remove(batches[0])
+		batches = batches[1:]
+	}
+	return nil
+}
+
+//batch files sorted from oldest to newest
+func (spool *Spool) batches() []string {
+	dirList, err := ioutil.ReadDir(spool.dir)
+	batches := make([]string, 0)
+	if err != nil {
+		Diag.Errorf("read spool dir error, dir : %q , %v", spool.dir, err)
+		return batches
+	}
+	for _, info := range dirList {
+		if strings.HasSuffix(info.Name(), ".json") {
+			batches = append(batches, filepath.Join(spool.dir, info.Name()))
+		}
+	}
+	sort.Strings(batches)
+	return batches
+}
+
+func (spool *Spool) Len() int {
+	return len(spool.batches())
+}
+
+//replay batches from oldest to newest with write, stop at the first failure and back off before the next try
+//batches are replayed as they were saved, so docs keep their original created time
+func (spool *Spool) Replay(write func(docs []PageCacheDoc) error) (int, error) {
+	if time.Now().Before(spool.nextReplay) {
+		return 0, nil
+	}
+	replayed := 0
+	for _, batch := range spool.batches() {
+		body, err := ioutil.ReadFile(batch)
+		if err != nil {
+			return replayed, spool.fail(fmt.Errorf("read spool error, file: %s, %v", batch, err))
+		}
+		docs := make([]PageCacheDoc, 0)
+		if err := json.Unmarshal(body, &docs); err != nil {
+			//a broken batch can never be written, drop it
+			Diag.Warnf("drop broken spool batch %s, %v", batch, err)
+			os.Remove(batch)
+			continue
+		}
+		if err := write(docs); err != nil {
+			return replayed, spool.fail(fmt.Errorf("replay spool batch %s error, %w", batch, err))
+		}
+		os.Remove(batch)
+		replayed++
+	}
+	spool.backoff = 0
+	return replayed, nil
+}
+
+func (spool *Spool) fail(err error) error {
+	if spool.backoff == 0 {
+		spool.backoff = SPOOL_MIN_BACKOFF
+	} else {
+		spool.backoff *= 2
+		if spool.backoff > SPOOL_MAX_BACKOFF {
+			spool.backoff = SPOOL_MAX_BACKOFF
+		}
+	}
+	spool.nextReplay = time.Now().Add(spool.backoff)
+	return err
+}
@@ -22,9 +22,30 @@ type Shard struct {
 	nodeName  string
 	uuid      string
 	primary   bool
+	//STARTED, RELOCATING or INITIALIZING
+	state string
+	store storeStat
+	//segments from _cat/segments, nil if they are unknown
+	segmentInfos map[string]segmentInfo
+	//highest generation of segmentInfos, -1 if there is none
+	maxGeneration int64
+	//pages of segment files by segment state
+	segmentCache map[string]int
+	//deleted files that es still holds open
+	deletedFiles []deletedFile
+	//creation date of the index in ms, it decides the first owner of hard-linked files
+	creationDate int64
+	closed       bool
+	//pages of files hard-linked with other shards and the indices of those shards
+	sharedCache int
+	sharedWith  map[string]bool
+	//every file with the cache attributed to the shard, only if KEEP_FILE_STATS
+	files []FileSnapshot
 
 	//MB
 	pageCache      int
+	pages          int
+	size           int64
 	fileSuffixStat FileSuffixStat
 }
 
@@ -32,26 +53,80 @@ func (shard Shard) getShardKey() string {
 	return shard.indexName + "|" + shard.shardId + "|" + shard.nodeName
 }
 
-func (shard *Shard) stats(rootPath string) {
+//keep the files of every shard of the cycle, they are saved as a snapshot by -save
+var KEEP_FILE_STATS = false
+
+func (shard *Shard) keepFile(file FileSnapshot) {
+	if KEEP_FILE_STATS {
+		shard.files = append(shard.files, file)
+	}
+}
+
+//files with other links are kept in links, key is the key of the shard in its ShardMap
+func (shard *Shard) stats(rootPath string, key string, links *hardLinks) {
 	shardPath := shard.getShardPath(rootPath)
 	files := getFiles(shardPath)
 	files = fileSuffixFilter(files)
 	fileSuffixStat := FileSuffixStat{}
-	pcStatusList := es_pcstat.GetPcStatusFiles(files)
+	segmentCache := map[string]int{}
+	shard.sharedWith = map[string]bool{}
+	shard.files = nil
 	cached := 0
-	for _, pcStatus := range pcStatusList {
+	pages := 0
+	var size int64
+	for _, file := range files {
+		pcStatus, err := es_pcstat.GetPcStatus(file)
+		if err != nil {
+			countError(ERROR_MMAP, "skipping %q: %v", file, err)
+			continue
+		}
+		segmentState := ""
+		if shard.segmentInfos != nil {
+			segmentState = shard.getSegmentState(path.Base(file))
+		}
+		if links.add(file, pcStatus, linkedFile{shardKey: key, name: path.Base(file), suffix: getFileSuffix(pcStatus.Name),
+			segmentState: segmentState}) {
+			continue
+		}
+		shard.keepFile(FileSnapshot{File: path.Base(file), Suffix: getFileSuffix(pcStatus.Name), Size: pcStatus.Size,
+			Pages: pcStatus.Pages, Cached: pcStatus.Cached, Segment: segmentState})
 		cached += pcStatus.Cached
+		pages += pcStatus.Pages
+		size += pcStatus.Size
 		fileSuffixStat.Add(getFileSuffix(pcStatus.Name), pcStatus.Cached, shard.primary)
+		if segmentState != "" {
+			segmentCache[segmentState] += pcStatus.Cached
+		}
+	}
+	//deleted files are counted as suffix "deleted", they are all left by merges
+	for _, file := range shard.deletedFiles {
+		pcStatus, err := es_pcstat.GetPcStatus(file.fd)
+		if err != nil {
+			countError(ERROR_MMAP, "skipping deleted file %q: %v", file.name, err)
+			continue
+		}
+		shard.keepFile(FileSnapshot{File: file.name, Suffix: DELETED_SUFFIX, Size: pcStatus.Size, Pages: pcStatus.Pages,
+			Cached: pcStatus.Cached, Deleted: true})
+		cached += pcStatus.Cached
+		pages += pcStatus.Pages
+		size += pcStatus.Size
+		fileSuffixStat.Add(DELETED_SUFFIX, pcStatus.Cached, shard.primary)
+		segmentCache[DELETED_SUFFIX] += pcStatus.Cached
 	}
 	shard.fileSuffixStat = fileSuffixStat
+	if shard.segmentInfos != nil || len(shard.deletedFiles) > 0 {
+		shard.segmentCache = segmentCache
+	}
 	shard.pageCache = cached
+	shard.pages = pages
+	shard.size = size
 }
 
 func getFiles(path string) []string {
 	dirList, e := ioutil.ReadDir(path)
 	files := make([]string, 0)
 	if e != nil {
-		fmt.Printf("read dir error, dir : %q , %v", path, e)
+		countError(ERROR_READDIR, "read dir error, dir : %q , %v", path, e)
 		return files
 	}
 	for _, info := range dirList {
@@ -81,29 +156,73 @@ func (shard Shard) getShardPath(rootPath string) string {
 type Index struct {
 	indexName string
 	uuid      string
+	//alias, data stream or pattern group of the index, "" if none
+	group  string
+	closed bool
 
 	priPageCache   int
 	repPageCache   int
 	pageCache      int //total
+	pages          int
+	size           int64
+	shardCount     int
 	fileSuffixStat FileSuffixStat
+	//pages of shards that are not started, by state
+	priStateCache map[string]int
+	repStateCache map[string]int
+	priStore      storeStat
+	repStore      storeStat
+	//pages of segment files by segment state
+	priSegmentCache map[string]int
+	repSegmentCache map[string]int
+	//pages of files hard-linked with other indices, and those indices
+	priSharedCache int
+	repSharedCache int
+	sharedWith     map[string]bool
+	creationDate   int64
 }
 
 type ShardMap map[string]Shard
 
 func (shardMap ShardMap) Stats(rootPath string) IndexStats {
 	indexMap := IndexMap{}
-	total := Index{indexName: "total", pageCache: 0, fileSuffixStat: FileSuffixStat{}, priPageCache: 0, repPageCache: 0}
+	total := Index{indexName: "total", pageCache: 0, fileSuffixStat: FileSuffixStat{}, priPageCache: 0, repPageCache: 0,
+		priStateCache: map[string]int{}, repStateCache: map[string]int{}, priSegmentCache: map[string]int{}, repSegmentCache: map[string]int{},
+		sharedWith: map[string]bool{}}
 	indexStats := IndexStats{indexMap: indexMap, total: total}
-	for _, shard := range shardMap {
-		shard.stats(rootPath)
+	if KEEP_FILE_STATS {
+		indexStats.shards = make([]Shard, 0, len(shardMap))
+	}
+
+	//hard-linked files are attributed after every shard is read
+	links := newHardLinks()
+	keys := sortShardsByOwner(shardMap)
+	shards := make(map[string]*Shard, len(keys))
+	for _, key := range keys {
+		shard := shardMap[key]
+		shard.stats(rootPath, key, links)
+		shards[key] = &shard
+	}
+	links.attribute(shards)
+
+	for _, key := range keys {
+		shard := *shards[key]
+		if KEEP_FILE_STATS {
+			indexStats.shards = append(indexStats.shards, shard)
+		}
 		indexMap.addShardForStats(shard)
 		// can not use total.pageCache,because total and indexStats.total are not same obj
 		indexStats.total.pageCache += shard.pageCache
+		indexStats.total.pages += shard.pages
+		indexStats.total.size += shard.size
+		indexStats.total.shardCount++
 		if shard.primary {
 			indexStats.total.priPageCache += shard.pageCache
 		} else {
 			indexStats.total.repPageCache += shard.pageCache
 		}
+		indexStats.total.addStateCache(shard)
+		indexStats.total.addStore(shard)
 		indexStats.total.fileSuffixStat.AddAll(shard.fileSuffixStat, shard.primary)
 	}
 	return indexStats
@@ -117,42 +236,105 @@ func (indexMap IndexMap) addShardForStats(shard Shard) IndexMap {
 		index.pageCache += shard.pageCache
 	} else {
 		index = Index{indexName: shard.indexName, pageCache: shard.pageCache, uuid: shard.uuid, fileSuffixStat: FileSuffixStat{},
-			repPageCache: 0, priPageCache: 0}
+			repPageCache: 0, priPageCache: 0, priStateCache: map[string]int{}, repStateCache: map[string]int{},
+			priSegmentCache: map[string]int{}, repSegmentCache: map[string]int{}, sharedWith: map[string]bool{}}
 	}
+	index.pages += shard.pages
+	index.size += shard.size
+	index.shardCount++
 	if shard.primary {
 		index.priPageCache += shard.pageCache
 	} else {
 		index.repPageCache += shard.pageCache
 	}
+	index.addStateCache(shard)
+	index.addStore(shard)
 
 	index.fileSuffixStat.AddAll(shard.fileSuffixStat, shard.primary)
 	indexMap[shard.indexName] = index
 	return indexMap
 }
 
+//started shards are not counted, their cache is the rest of pageCache
+func (index *Index) addStateCache(shard Shard) {
+	if shard.state == "" || shard.state == SHARD_STATE_STARTED {
+		return
+	}
+	if shard.primary {
+		index.priStateCache[shard.state] += shard.pageCache
+	} else {
+		index.repStateCache[shard.state] += shard.pageCache
+	}
+}
+
+func (index *Index) addStore(shard Shard) {
+	segmentCache := index.repSegmentCache
+	if shard.primary {
+		index.priStore.add(shard.store)
+		index.priSharedCache += shard.sharedCache
+		segmentCache = index.priSegmentCache
+	} else {
+		index.repStore.add(shard.store)
+		index.repSharedCache += shard.sharedCache
+	}
+	for indexName := range shard.sharedWith {
+		index.sharedWith[indexName] = true
+	}
+	for state, cached := range shard.segmentCache {
+		segmentCache[state] += cached
+	}
+}
+
+//pages of segment files in state, primary and replica
+func (index Index) segmentCache(state string) int {
+	return index.priSegmentCache[state] + index.repSegmentCache[state]
+}
+
+//store of primary and replica
+func (index Index) store() storeStat {
+	store := index.priStore
+	store.add(index.repStore)
+	return store
+}
+
+//pages of shards in state, primary and replica
+func (index Index) stateCache(state string) int {
+	return index.priStateCache[state] + index.repStateCache[state]
+}
+
 type IndexStats struct {
 	indexMap IndexMap
 	total    Index
+	errors   ErrorStats
+	node     NodeInfo
+	//shards with their files, only if KEEP_FILE_STATS
+	shards []Shard
+}
+
+//errors counted while collecting, they are written with the stats
+func (indexStats IndexStats) WithErrors(errors ErrorStats) IndexStats {
+	indexStats.errors = errors
+	return indexStats
 }
 
-func (indexStats IndexStats) FormatForConsole(sortByCache bool) {
+//get index by name, "total" returns the total row
+func (indexStats IndexStats) getIndex(indexName string) *Index {
+	if indexName == indexStats.total.indexName {
+		return &indexStats.total
+	}
+	index, exist := indexStats.indexMap[indexName]
+	if !exist {
+		return nil
+	}
+	return &index
+}
+
+func (indexStats IndexStats) FormatForConsole(sortByCache bool, columnNames []string, lastStats *IndexStats) {
 	indexMap := indexStats.indexMap
 	total := indexStats.total
+	columns := getConsoleColumns(columnNames)
 	maxName := indexMap.maxNameLen()
-	fmt.Printf("max len , %d \n", maxName)
-	// create horizontal grid line
-	titleBlank := maxName - 9
-	if titleBlank < 0 {
-		titleBlank = 0
-	}
-	title := fmt.Sprintf("| index_name%s| cache (MB) | pri cache  | rep cache  |", strings.Repeat(" ", titleBlank))
-
-	pad := strings.Repeat("-", maxName+2)
-	top := fmt.Sprintf("+%s+------------+------------+------------+", pad)
-	bot := fmt.Sprintf("+%s+------------+------------+------------+", pad)
-
-	fmt.Println(title)
-	fmt.Println(top)
+	Diag.Debugf("max len , %d", maxName)
 
 	indexList := make([]Index, 0)
 	for _, index := range indexMap {
@@ -164,38 +346,100 @@ func (indexStats IndexStats) FormatForConsole(sortByCache bool) {
 			return indexList[i].pageCache > indexList[j].pageCache
 		})
 	}
-
-	// %07.3f was chosen to make it easy to scan the percentages vertically
-	// I tried a few different formats only this one kept the decimals aligned
+	indexList = append(indexList, total)
+
+	// render every cell first, the width of each column is decided by its title and longest value
+	rows := make([][]string, 0, len(indexList))
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = len(column.title) + 2
+		if widths[i] < 12 {
+			widths[i] = 12
+		}
+	}
 	for _, index := range indexList {
-		pad = strings.Repeat(" ", maxName-len(index.indexName))
+		var last *Index
+		if lastStats != nil {
+			last = lastStats.getIndex(index.indexName)
+		}
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = column.value(index, last)
+			if len(row[i])+2 > widths[i] {
+				widths[i] = len(row[i]) + 2
+			}
+		}
+		rows = append(rows, row)
+	}
 
-		fmt.Printf("| %s%s |  %-10d|  %-10d|  %-10d|\n",
-			index.indexName, pad, index.pageCache/FOUR_KB_TO_MB, index.priPageCache/FOUR_KB_TO_MB, index.repPageCache/FOUR_KB_TO_MB)
+	// create horizontal grid line
+	titleBlank := maxName - 9
+	if titleBlank < 0 {
+		titleBlank = 0
+	}
+	title := fmt.Sprintf("| index_name%s|", strings.Repeat(" ", titleBlank))
+	grid := fmt.Sprintf("+%s+", strings.Repeat("-", maxName+2))
+	for i, column := range columns {
+		title += fmt.Sprintf(" %-*s|", widths[i]-1, column.title)
+		grid += strings.Repeat("-", widths[i]) + "+"
 	}
 
-	pad = strings.Repeat(" ", maxName-len(total.indexName))
-	fmt.Printf("| %s%s |  %-10d|  %-10d|  %-10d|\n",
-		total.indexName, pad, total.pageCache/FOUR_KB_TO_MB, total.priPageCache/FOUR_KB_TO_MB, total.repPageCache/FOUR_KB_TO_MB)
+	fmt.Println(title)
+	fmt.Println(grid)
 
-	fmt.Println(bot)
+	for i, index := range indexList {
+		pad := strings.Repeat(" ", maxName-len(index.indexName))
+		line := fmt.Sprintf("| %s%s |", index.indexName, pad)
+		for j, cell := range rows[i] {
+			line += fmt.Sprintf("  %-*s|", widths[j]-2, cell)
+		}
+		fmt.Println(line)
+	}
+
+	fmt.Println(grid)
+	if indexStats.errors != nil {
+		fmt.Printf("errors: %s\n", indexStats.errors)
+	}
 }
 
-func (indexStats IndexStats) FormatForSLS(clusterName string, nodeName string, createdTime time.Time) {
+func (indexStats IndexStats) FormatForSLS(logger *log.Logger, clusterName string, nodeName string, createdTime time.Time) {
 	docs := indexStats.getStatDocs(clusterName, nodeName, createdTime)
-	formatIndexForSLS(docs)
+	formatIndexForSLS(logger, docs)
 }
 
-func formatIndexForSLS(docs []PageCacheDoc) {
+func formatIndexForSLS(logger *log.Logger, docs []PageCacheDoc) {
 	for _, doc := range docs {
-		log.WithFields(log.Fields{
+		fields := log.Fields{
 			"index_name":   doc.IndexName,
 			"cache":        doc.Cache,
 			"primary":      doc.Primary,
 			"node_name":    doc.NodeName,
 			"time":         doc.Created,
 			"cluster_name": doc.ClusterName,
-		}).Info()
+
+			"docs":                   doc.Docs,
+			"store_size":             doc.StoreSize,
+			"segments":               doc.Segments,
+			"segment_memory":         doc.SegmentMemory,
+			"cache_per_gb":           doc.CachePerGb,
+			"cache_per_million_docs": doc.CachePerMillionDocs,
+		}
+		if doc.Errors != nil {
+			fields["errors"] = doc.Errors
+		}
+		if doc.Group != "" {
+			fields["group"] = doc.Group
+		}
+		if doc.NodeRoles != nil {
+			fields["node_roles"] = doc.NodeRoles
+		}
+		if doc.NodeAttributes != nil {
+			fields["node_attributes"] = doc.NodeAttributes
+		}
+		if doc.NodeTier != "" {
+			fields["node_tier"] = doc.NodeTier
+		}
+		logger.WithFields(fields).Info()
 	}
 }
 
@@ -203,10 +447,11 @@ func (indexStats *IndexStats) sort() {
 
 }
 
-func (indexStats IndexStats) WriteToEs(client elastic.Client, clusterName string, nodeName string, createdTime time.Time) {
+func (indexStats IndexStats) WriteToEs(client *elastic.Client, version ClusterVersion, clusterName string, nodeName string, createdTime time.Time) error {
 	docs := indexStats.getStatDocs(clusterName, nodeName, createdTime)
 
-	PostPcstatData(client, docs)
+	_, err := PostPcstatData(client, version, docs)
+	return err
 }
 
 func (indexStats IndexStats) getStatDocs(clusterName string, nodeName string, createdTime time.Time) []PageCacheDoc {
@@ -218,7 +463,13 @@ func (indexStats IndexStats) getStatDocs(clusterName string, nodeName string, cr
 		docs = appendDocs(docs, doc)
 	}
 	doc := getPageCacheDoc(total, clusterName, nodeName, createdTime)
+	doc[0].Errors = indexStats.errors
 	docs = appendDocs(docs, doc)
+	for i := range docs {
+		docs[i].NodeRoles = indexStats.node.Roles
+		docs[i].NodeAttributes = indexStats.node.Attributes
+		docs[i].NodeTier = indexStats.node.Tier
+	}
 	return docs
 }
 
@@ -239,7 +490,7 @@ func getPageCacheDoc(index Index, clusterName string, nodeName string, createdTi
 
 func getPageCacheDocWithPr(index Index, clusterName string, nodeName string, createdTime time.Time, primary bool) PageCacheDoc {
 	doc := PageCacheDoc{ClusterName: clusterName, NodeName: nodeName, Created: createdTime, IndexName: index.indexName,
-		Primary: primary}
+		Primary: primary, Group: index.group}
 
 	cache := map[string]int{}
 	indexTotalCache := 0
@@ -258,6 +509,41 @@ func getPageCacheDocWithPr(index Index, clusterName string, nodeName string, cre
 	cache["total"] = indexTotalCache / FOUR_KB_TO_MB
 	doc.Cache = cache
 
+	stateCache := index.repStateCache
+	store := index.repStore
+	segmentCache := index.repSegmentCache
+	if primary {
+		stateCache = index.priStateCache
+		store = index.priStore
+		segmentCache = index.priSegmentCache
+	}
+	doc.SharedCache = index.repSharedCache / FOUR_KB_TO_MB
+	if primary {
+		doc.SharedCache = index.priSharedCache / FOUR_KB_TO_MB
+	}
+	for indexName := range index.sharedWith {
+		doc.SharedWith = append(doc.SharedWith, indexName)
+	}
+	sort.Strings(doc.SharedWith)
+	if len(segmentCache) > 0 {
+		doc.SegmentCache = map[string]int{}
+		for state, cached := range segmentCache {
+			doc.SegmentCache[state] = cached / FOUR_KB_TO_MB
+		}
+	}
+	doc.Docs = store.docs
+	doc.StoreSize = store.storeSize
+	doc.Segments = store.segments
+	doc.SegmentMemory = store.segmentMemory
+	doc.CachePerGb = cachePerGb(indexTotalCache, store.storeSize)
+	doc.CachePerMillionDocs = cachePerMillionDocs(indexTotalCache, store.docs)
+	if len(stateCache) > 0 {
+		doc.State = map[string]int{}
+		for state, cached := range stateCache {
+			doc.State[strings.ToLower(state)] = cached / FOUR_KB_TO_MB
+		}
+	}
+
 	return doc
 }
 
@@ -0,0 +1,64 @@
+package es_collect
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{"created", "cluster_name", "node_name", "index_name", "primary", "suffix", "cache", "node_tier"}
+
+//header is written only once, so the output of many cycles can be loaded as one table
+var csvHeaderWritten = false
+
+//one row per index, primary/replica and file suffix, cache is MB
+func (indexStats IndexStats) FormatForCsv(clusterName string, nodeName string, createdTime time.Time) {
+	docs := indexStats.getStatDocs(clusterName, nodeName, createdTime)
+	formatIndexForCsv(docs)
+}
+
+func formatIndexForCsv(docs []PageCacheDoc) {
+	writer := csv.NewWriter(os.Stdout)
+	if !csvHeaderWritten {
+		writer.Write(csvHeader)
+		csvHeaderWritten = true
+	}
+	for _, doc := range docs {
+		suffixes := make([]string, 0, len(doc.Cache))
+		for suffix := range doc.Cache {
+			suffixes = append(suffixes, suffix)
+		}
+		sort.Strings(suffixes)
+		for _, suffix := range suffixes {
+			writer.Write([]string{doc.Created.Format(time.RFC3339), doc.ClusterName, doc.NodeName, doc.IndexName,
+				strconv.FormatBool(doc.Primary), suffix, strconv.Itoa(doc.Cache[suffix]), doc.NodeTier})
+		}
+		//errors of the cycle are rows of index "errors", suffix is the category and cache is the count
+		categories := make([]string, 0, len(doc.Errors))
+		for category := range doc.Errors {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for _, category := range categories {
+			writer.Write([]string{doc.Created.Format(time.RFC3339), doc.ClusterName, doc.NodeName, "errors",
+				"", category, strconv.Itoa(doc.Errors[category]), doc.NodeTier})
+		}
+	}
+	writer.Flush()
+}
+
+//one PageCacheDoc per line
+func (indexStats IndexStats) FormatForJsonLines(clusterName string, nodeName string, createdTime time.Time) {
+	docs := indexStats.getStatDocs(clusterName, nodeName, createdTime)
+	formatIndexForJsonLines(docs)
+}
+
+func formatIndexForJsonLines(docs []PageCacheDoc) {
+	encoder := json.NewEncoder(os.Stdout)
+	for _, doc := range docs {
+		encoder.Encode(doc)
+	}
+}
@@ -0,0 +1,221 @@
+package es_collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//docs, store and segments of shards on this node, from _cat/shards and _cat/segments
+type storeStat struct {
+	docs          int64
+	storeSize     int64 //bytes
+	segments      int
+	segmentMemory int64 //bytes
+}
+
+func (stat *storeStat) add(other storeStat) {
+	stat.docs += other.docs
+	stat.storeSize += other.storeSize
+	stat.segments += other.segments
+	stat.segmentMemory += other.segmentMemory
+}
+
+//MB of cache per GB stored, 0 if nothing is stored
+func cachePerGb(pageCache int, storeSize int64) float64 {
+	if storeSize == 0 {
+		return 0
+	}
+	return float64(pageCache) / float64(FOUR_KB_TO_MB) / (float64(storeSize) / 1024 / 1024 / 1024)
+}
+
+//MB of cache per million docs, 0 if there is no doc
+func cachePerMillionDocs(pageCache int, docs int64) float64 {
+	if docs == 0 {
+		return 0
+	}
+	return float64(pageCache) / float64(FOUR_KB_TO_MB) / (float64(docs) / 1000000)
+}
+
+//values of _cat are strings and null for shards that are not started
+func parseCatNumber(value *string) int64 {
+	if value == nil {
+		return 0
+	}
+	number, _ := strconv.ParseInt(*value, 10, 64)
+	return number
+}
+
+type catSegmentRow struct {
+	Index      string  `json:"index"`
+	Shard      string  `json:"shard"`
+	Id         string  `json:"id"`
+	Segment    string  `json:"segment"`
+	Generation string  `json:"generation"`
+	Committed  string  `json:"committed"`
+	Searchable string  `json:"searchable"`
+	Size       *string `json:"size"`
+	SizeMemory *string `json:"size.memory"`
+	Version    string  `json:"version"`
+	Compound   string  `json:"compound"`
+}
+
+//lucene segment of a shard from _cat/segments
+type segmentInfo struct {
+	name       string
+	generation string
+	committed  bool
+	searchable bool
+	size       int64
+	version    string
+	compound   bool
+}
+
+//count segments and their heap of every shard on the node of nodeId, and keep the segments to classify the
+//cache of segment files in Shard.stats
+func FillShardMapSegments(client Client, shardMap ShardMap, nodeId string) ShardMap {
+	if nodeId == "" || len(shardMap) == 0 {
+		return shardMap
+	}
+	//a node holds one copy of a shard, so index and shard find it
+	//a started shard without rows has no segment, its segment files are all newer than the known ones.
+	//recovering shards and closed indices have no rows at all, their files are not classified
+	shardKeys := map[string]string{}
+	indexSet := map[string]bool{}
+	for key, shard := range shardMap {
+		if shard.closed || (shard.state != SHARD_STATE_STARTED && shard.state != SHARD_STATE_RELOCATING) {
+			continue
+		}
+		shardKeys[shard.indexName+"|"+shard.shardId] = key
+		indexSet[shard.indexName] = true
+	}
+	if len(indexSet) == 0 {
+		return shardMap
+	}
+	rows, err := getCatSegments(client, indexSet)
+	if err != nil {
+		countError(ERROR_ES_API, "get segments error, %v", err)
+		return shardMap
+	}
+	for _, key := range shardKeys {
+		shard := shardMap[key]
+		shard.segmentInfos = map[string]segmentInfo{}
+		shard.maxGeneration = -1
+		shardMap[key] = shard
+	}
+	for _, row := range rows {
+		if row.Id != nodeId {
+			continue
+		}
+		key, exist := shardKeys[row.Index+"|"+row.Shard]
+		if !exist {
+			continue
+		}
+		shard := shardMap[key]
+		shard.store.segments++
+		shard.store.segmentMemory += parseCatNumber(row.SizeMemory)
+		shard.segmentInfos[row.Segment] = segmentInfo{name: row.Segment, generation: row.Generation, committed: row.Committed == "true",
+			searchable: row.Searchable == "true", size: parseCatNumber(row.Size), version: row.Version, compound: row.Compound == "true"}
+		if generation := getSegmentGeneration(row.Segment); generation > shard.maxGeneration {
+			shard.maxGeneration = generation
+		}
+		shardMap[key] = shard
+	}
+	return shardMap
+}
+
+//max length of the index list in one _cat/segments request, es rejects a request line over 4kb by default
+var CAT_SEGMENTS_MAX_PATH = 3000
+
+//segments of the local indices only, the indices are sent in as few requests as the path length allows
+func getCatSegments(client Client, indexSet map[string]bool) ([]catSegmentRow, error) {
+	indices := make([]string, 0, len(indexSet))
+	for indexName := range indexSet {
+		indices = append(indices, url.PathEscape(indexName))
+	}
+	sort.Strings(indices)
+	rows := make([]catSegmentRow, 0)
+	for start := 0; start < len(indices); {
+		end := start + 1
+		length := len(indices[start])
+		for end < len(indices) && length+1+len(indices[end]) <= CAT_SEGMENTS_MAX_PATH {
+			length += 1 + len(indices[end])
+			end++
+		}
+		body, err := httpGetRequest(client.getUrl("/_cat/segments/"+strings.Join(indices[start:end], ",")+
+			"?format=json&bytes=b&h=index,shard,id,segment,generation,committed,searchable,size,size.memory,version,compound"),
+			client.User, client.Password)
+		if err != nil {
+			return nil, err
+		}
+		batch := make([]catSegmentRow, 0)
+		if err := json.Unmarshal([]byte(body), &batch); err != nil {
+			return nil, fmt.Errorf("parse segments error, %v", err)
+		}
+		rows = append(rows, batch...)
+		start = end
+	}
+	return rows, nil
+}
+
+//cache of segment files by the state of their segment
+const (
+	SEGMENT_LIVE         = "live"
+	SEGMENT_UNSEARCHABLE = "unsearchable"
+	SEGMENT_COMMITTED    = "committed"
+	SEGMENT_MERGED       = "merged"
+	SEGMENT_NEW          = "new"
+	SEGMENT_OTHER        = "other"
+)
+
+//segment of a lucene file, _1k.fdt, _1k_Lucene84_0.tim and _1k_1.liv are of segment _1k,
+//"" for files of no segment like segments_N and write.lock
+func getSegmentName(fileName string) string {
+	if !strings.HasPrefix(fileName, "_") {
+		return ""
+	}
+	end := strings.IndexAny(fileName[1:], "_.")
+	if end < 0 {
+		return ""
+	}
+	return fileName[:end+1]
+}
+
+//generation of a segment is its name after "_" in base 36, _1k is 56, -1 if the name is not a segment
+func getSegmentGeneration(segmentName string) int64 {
+	if !strings.HasPrefix(segmentName, "_") {
+		return -1
+	}
+	generation, err := strconv.ParseInt(segmentName[1:], 36, 64)
+	if err != nil {
+		return -1
+	}
+	return generation
+}
+
+//a segment that is not searchable is written but not refreshed yet, or held only by the last commit if it is committed.
+//a segment missing from _cat/segments is new if its generation is above every known one, like the output of a running
+//merge or a flush after _cat/segments was got, otherwise it is merged away and still on disk because a reader holds it
+func (shard Shard) getSegmentState(fileName string) string {
+	segmentName := getSegmentName(fileName)
+	if segmentName == "" {
+		return SEGMENT_OTHER
+	}
+	segment, exist := shard.segmentInfos[segmentName]
+	if !exist {
+		if getSegmentGeneration(segmentName) > shard.maxGeneration {
+			return SEGMENT_NEW
+		}
+		return SEGMENT_MERGED
+	}
+	if !segment.searchable {
+		if segment.committed {
+			return SEGMENT_COMMITTED
+		}
+		return SEGMENT_UNSEARCHABLE
+	}
+	return SEGMENT_LIVE
+}
@@ -0,0 +1,85 @@
+package es_collect
+
+import "testing"
+
+func TestGetSegmentState(t *testing.T) {
+	shard := Shard{segmentInfos: map[string]segmentInfo{
+		"_a":  {name: "_a", committed: true, searchable: true},
+		"_b":  {name: "_b", committed: false, searchable: false},
+		"_c":  {name: "_c", committed: true, searchable: false},
+		"_1k": {name: "_1k", committed: false, searchable: true},
+	}, maxGeneration: 56}
+	tests := []struct {
+		file  string
+		state string
+	}{
+		{"_a.fdt", SEGMENT_LIVE},
+		{"_1k_Lucene84_0.tim", SEGMENT_LIVE},
+		{"_b.cfs", SEGMENT_UNSEARCHABLE},
+		{"_c.cfs", SEGMENT_COMMITTED},
+		{"_9.cfs", SEGMENT_MERGED},
+		{"_1j_1.liv", SEGMENT_MERGED},
+		{"_1l.fdt", SEGMENT_NEW},
+		{"_2s_Lucene90_0.doc", SEGMENT_NEW},
+		{"segments_5", SEGMENT_OTHER},
+		{"write.lock", SEGMENT_OTHER},
+	}
+	for _, test := range tests {
+		if state := shard.getSegmentState(test.file); state != test.state {
+			t.Errorf("getSegmentState(%q) = %q, want %q", test.file, state, test.state)
+		}
+	}
+
+	empty := Shard{segmentInfos: map[string]segmentInfo{}, maxGeneration: -1}
+	if state := empty.getSegmentState("_0.cfs"); state != SEGMENT_NEW {
+		t.Errorf("getSegmentState of a shard without segments = %q, want %q", state, SEGMENT_NEW)
+	}
+}
+
+func TestGetSegmentGeneration(t *testing.T) {
+	tests := map[string]int64{"_0": 0, "_a": 10, "_1k": 56, "_zz": 1295, "segments": -1, "_": -1, "_a-b": -1}
+	for name, generation := range tests {
+		if got := getSegmentGeneration(name); got != generation {
+			t.Errorf("getSegmentGeneration(%q) = %d, want %d", name, got, generation)
+		}
+	}
+}
+
+func TestFillShardMapSegments(t *testing.T) {
+	defer func(maxPath int) { CAT_SEGMENTS_MAX_PATH = maxPath }(CAT_SEGMENTS_MAX_PATH)
+	CAT_SEGMENTS_MAX_PATH = len("logs,metrics")
+	client, server := newTestClient(t, map[string]string{
+		"/_cat/segments/logs,metrics": `[
+			{"index":"logs","shard":"0","id":"node-1-id","segment":"_0","generation":"0","committed":"true","searchable":"true","size":"100","size.memory":"10"},
+			{"index":"logs","shard":"0","id":"node-1-id","segment":"_1","generation":"1","committed":"false","searchable":"false","size":"50","size.memory":"5"},
+			{"index":"logs","shard":"0","id":"node-2-id","segment":"_2","generation":"2","committed":"true","searchable":"true","size":"100","size.memory":"10"}
+		]`,
+		"/_cat/segments/traces": `[]`,
+	})
+	defer server.Close()
+	shardMap := ShardMap{
+		"logs|0|node-1":    {indexName: "logs", shardId: "0", nodeName: "node-1", state: SHARD_STATE_STARTED},
+		"metrics|0|node-1": {indexName: "metrics", shardId: "0", nodeName: "node-1", state: SHARD_STATE_RELOCATING},
+		"traces|0|node-1":  {indexName: "traces", shardId: "0", nodeName: "node-1", state: SHARD_STATE_STARTED},
+		"closed|0|node-1":  {indexName: "closed", shardId: "0", nodeName: "node-1", state: SHARD_STATE_STARTED, closed: true},
+		"events|0|node-1":  {indexName: "events", shardId: "0", nodeName: "node-1", state: SHARD_STATE_INITIALIZING},
+	}
+	TakeErrorStats()
+	shardMap = FillShardMapSegments(client, shardMap, "node-1-id")
+	if errors := TakeErrorStats(); errors.total() != 0 {
+		t.Fatalf("errors %s", errors)
+	}
+	logs := shardMap["logs|0|node-1"]
+	if logs.store.segments != 2 || logs.store.segmentMemory != 15 || logs.maxGeneration != 1 {
+		t.Errorf("logs segments %d, memory %d, max generation %d, want 2, 15, 1", logs.store.segments, logs.store.segmentMemory, logs.maxGeneration)
+	}
+	if metrics := shardMap["metrics|0|node-1"]; metrics.segmentInfos == nil || len(metrics.segmentInfos) != 0 || metrics.maxGeneration != -1 {
+		t.Errorf("metrics segments %v, max generation %d, want none known", metrics.segmentInfos, metrics.maxGeneration)
+	}
+	//closed and recovering shards are not asked for
+	for _, key := range []string{"closed|0|node-1", "events|0|node-1"} {
+		if shardMap[key].segmentInfos != nil {
+			t.Errorf("%s segments %v, want unknown", key, shardMap[key].segmentInfos)
+		}
+	}
+}
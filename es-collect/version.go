@@ -0,0 +1,171 @@
+package es_collect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/olivere/elastic.v6"
+)
+
+const (
+	DISTRIBUTION_ELASTICSEARCH = "elasticsearch"
+	DISTRIBUTION_OPENSEARCH    = "opensearch"
+)
+
+//version of the cluster, from GET /
+type ClusterVersion struct {
+	Distribution string
+	Number       string
+	Major        int
+	Minor        int
+}
+
+func (version ClusterVersion) String() string {
+	return version.Distribution + " " + version.Number
+}
+
+//es 6.x needs the _doc type in mapping and bulk, es 7 accepts typeless requests, es 8 and opensearch reject types
+func (version ClusterVersion) typed() bool {
+	return version.Distribution == DISTRIBUTION_ELASTICSEARCH && version.Major < 7
+}
+
+func (version ClusterVersion) isOpenSearch() bool {
+	return version.Distribution == DISTRIBUTION_OPENSEARCH
+}
+
+//composable index template and data stream are added in es 7.9 and opensearch 1.0
+func (version ClusterVersion) supportLifecycle() bool {
+	if version.isOpenSearch() {
+		return true
+	}
+	return version.Major > 7 || (version.Major == 7 && version.Minor >= 9)
+}
+
+//frozen indices are added in es 6.6 and removed in es 8, opensearch has none
+func (version ClusterVersion) supportFreeze() bool {
+	if version.Distribution != DISTRIBUTION_ELASTICSEARCH {
+		return false
+	}
+	return version.Major == 7 || (version.Major == 6 && version.Minor >= 6)
+}
+
+type rootResponse struct {
+	Version struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution"`
+	} `json:"version"`
+}
+
+func getClusterVersion(esClient *elastic.Client) (ClusterVersion, error) {
+	res, err := esClient.PerformRequest(context.TODO(), elastic.PerformRequestOptions{Method: "GET", Path: "/"})
+	if err != nil {
+		return ClusterVersion{}, fmt.Errorf("get cluster version error, %v", err)
+	}
+	root := rootResponse{}
+	if err := json.Unmarshal(res.Body, &root); err != nil {
+		return ClusterVersion{}, fmt.Errorf("parse cluster version error, %v", err)
+	}
+	return parseClusterVersion(root.Version.Number, root.Version.Distribution)
+}
+
+//version of the collected cluster
+func GetClusterVersion(client Client) (ClusterVersion, error) {
+	body, err := httpGetRequest(client.getUrl("/"), client.User, client.Password)
+	if err != nil {
+		return ClusterVersion{}, fmt.Errorf("get cluster version error, %v", err)
+	}
+	root := rootResponse{}
+	if err := json.Unmarshal([]byte(body), &root); err != nil {
+		return ClusterVersion{}, fmt.Errorf("parse cluster version error, %v", err)
+	}
+	return parseClusterVersion(root.Version.Number, root.Version.Distribution)
+}
+
+//indices directory under path.data, es 8.x removes the nodes/0 level, opensearch keeps it
+func GetIndicesPath(dataPath string, version ClusterVersion) string {
+	dataPath = strings.TrimSuffix(dataPath, "/")
+	if !version.isOpenSearch() && version.Major >= 8 {
+		return dataPath + "/indices"
+	}
+	return dataPath + "/nodes/0/indices"
+}
+
+//distribution is only returned by opensearch, es leaves it empty
+func parseClusterVersion(number string, distribution string) (ClusterVersion, error) {
+	version := ClusterVersion{Distribution: DISTRIBUTION_ELASTICSEARCH, Number: number}
+	if distribution == DISTRIBUTION_OPENSEARCH {
+		version.Distribution = DISTRIBUTION_OPENSEARCH
+	}
+	parts := strings.Split(number, ".")
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return version, fmt.Errorf("parse cluster version error, version: %q", number)
+	}
+	version.Major = major
+	if len(parts) > 1 {
+		version.Minor, _ = strconv.Atoi(parts[1])
+	}
+	return version, nil
+}
+
+//properties of PageCacheDoc, cache.* are the MB of every file suffix, state.* the MB of shards not started
+var pcstatProperties = map[string]interface{}{
+	"cluster_name": map[string]string{"type": "keyword"},
+	"created":      map[string]string{"type": "date"},
+	"index_name":   map[string]string{"type": "keyword"},
+	"group":        map[string]string{"type": "keyword"},
+	"node_name":    map[string]string{"type": "keyword"},
+	"node_roles":   map[string]string{"type": "keyword"},
+	"node_tier":    map[string]string{"type": "keyword"},
+	"primary":      map[string]string{"type": "boolean"},
+	"cache":        map[string]interface{}{"type": "object"},
+	"state":        map[string]interface{}{"type": "object"},
+
+	"docs":                   map[string]string{"type": "long"},
+	"store_size":             map[string]string{"type": "long"},
+	"segments":               map[string]string{"type": "long"},
+	"segment_memory":         map[string]string{"type": "long"},
+	"cache_per_gb":           map[string]string{"type": "float"},
+	"cache_per_million_docs": map[string]string{"type": "float"},
+	"segment_cache":          map[string]interface{}{"type": "object"},
+	"shared_cache":           map[string]string{"type": "long"},
+	"shared_with":            map[string]string{"type": "keyword"},
+}
+
+var pcstatDynamicTemplates = []map[string]interface{}{
+	{"cache_long": map[string]interface{}{
+		"path_match": "cache.*",
+		"mapping":    map[string]string{"type": "long"},
+	}},
+	{"errors_long": map[string]interface{}{
+		"path_match": "errors.*",
+		"mapping":    map[string]string{"type": "long"},
+	}},
+	{"node_attributes_keyword": map[string]interface{}{
+		"path_match": "node_attributes.*",
+		"mapping":    map[string]string{"type": "keyword"},
+	}},
+	{"segment_cache_long": map[string]interface{}{
+		"path_match": "segment_cache.*",
+		"mapping":    map[string]string{"type": "long"},
+	}},
+	{"state_long": map[string]interface{}{
+		"path_match": "state.*",
+		"mapping":    map[string]string{"type": "long"},
+	}},
+}
+
+//mappings of the pcstat index, with the _doc type for es 6.x
+func getPcstatMappings(version ClusterVersion) map[string]interface{} {
+	mappings := map[string]interface{}{
+		"dynamic_templates": pcstatDynamicTemplates,
+		"properties":        pcstatProperties,
+	}
+	if version.typed() {
+		return map[string]interface{}{"_doc": mappings}
+	}
+	return mappings
+}
@@ -0,0 +1,124 @@
+package es_collect
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseClusterVersion(t *testing.T) {
+	tests := []struct {
+		number       string
+		distribution string
+		want         ClusterVersion
+		wantErr      bool
+	}{
+		{"6.8.23", "", ClusterVersion{DISTRIBUTION_ELASTICSEARCH, "6.8.23", 6, 8}, false},
+		{"7.17.16", "", ClusterVersion{DISTRIBUTION_ELASTICSEARCH, "7.17.16", 7, 17}, false},
+		{"8.11.3", "", ClusterVersion{DISTRIBUTION_ELASTICSEARCH, "8.11.3", 8, 11}, false},
+		{"8.0.0-rc1", "", ClusterVersion{DISTRIBUTION_ELASTICSEARCH, "8.0.0-rc1", 8, 0}, false},
+		{"1.3.14", DISTRIBUTION_OPENSEARCH, ClusterVersion{DISTRIBUTION_OPENSEARCH, "1.3.14", 1, 3}, false},
+		{"2.11.1", DISTRIBUTION_OPENSEARCH, ClusterVersion{DISTRIBUTION_OPENSEARCH, "2.11.1", 2, 11}, false},
+		{"", "", ClusterVersion{}, true},
+	}
+	for _, test := range tests {
+		version, err := parseClusterVersion(test.number, test.distribution)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseClusterVersion(%q, %q) error = %v, want error %v", test.number, test.distribution, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && version != test.want {
+			t.Errorf("parseClusterVersion(%q, %q) = %+v, want %+v", test.number, test.distribution, version, test.want)
+		}
+	}
+}
+
+//responses recorded from every supported version, see testdata
+var versionFixtures = []struct {
+	dir         string
+	version     ClusterVersion
+	indicesPath string
+	typed       bool
+	lifecycle   bool
+	tier        string
+	//shard keys on node-1, closed indices have no shards before es 7.2
+	localShards []string
+}{
+	{"es-6.8", ClusterVersion{DISTRIBUTION_ELASTICSEARCH, "6.8.23", 6, 8}, "/data/nodes/0/indices", true, false, "hot",
+		[]string{"logs-2024.01.01|0|node-1", "logs-2024.01.01|1|node-1", "metrics|0|node-1"}},
+	{"es-7.17", ClusterVersion{DISTRIBUTION_ELASTICSEARCH, "7.17.16", 7, 17}, "/data/nodes/0/indices", false, true, "",
+		[]string{"logs-2024.01.01|0|node-1", "logs-2024.01.01|1|node-1", "metrics|0|node-1", "old|0|node-1"}},
+	{"es-8.11", ClusterVersion{DISTRIBUTION_ELASTICSEARCH, "8.11.3", 8, 11}, "/data/indices", false, true, "warm",
+		[]string{"logs-2024.01.01|0|node-1", "logs-2024.01.01|1|node-1", "metrics|0|node-1", "old|0|node-1"}},
+	{"opensearch-1.3", ClusterVersion{DISTRIBUTION_OPENSEARCH, "1.3.14", 1, 3}, "/data/nodes/0/indices", false, true, "",
+		[]string{"logs-2024.01.01|0|node-1", "logs-2024.01.01|1|node-1", "metrics|0|node-1", "old|0|node-1"}},
+	{"opensearch-2.11", ClusterVersion{DISTRIBUTION_OPENSEARCH, "2.11.1", 2, 11}, "/data/nodes/0/indices", false, true, "cold",
+		[]string{"logs-2024.01.01|0|node-1", "logs-2024.01.01|1|node-1", "metrics|0|node-1", "old|0|node-1"}},
+}
+
+func readFixture(t *testing.T, dir string, name string) string {
+	body, err := ioutil.ReadFile("testdata/" + dir + "/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestRecordedResponses(t *testing.T) {
+	for _, fixture := range versionFixtures {
+		t.Run(fixture.dir, func(t *testing.T) {
+			client, server := newTestClient(t, map[string]string{
+				"/":              readFixture(t, fixture.dir, "root.json"),
+				"/_cat/shards":   readFixture(t, fixture.dir, "cat_shards.json"),
+				"/_cat/indices":  readFixture(t, fixture.dir, "cat_indices.json"),
+				"/_nodes/node-1": readFixture(t, fixture.dir, "nodes.json"),
+			})
+			defer server.Close()
+			TakeErrorStats()
+
+			version, err := GetClusterVersion(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != fixture.version {
+				t.Errorf("version = %+v, want %+v", version, fixture.version)
+			}
+			if version.typed() != fixture.typed || version.supportLifecycle() != fixture.lifecycle {
+				t.Errorf("typed = %v, lifecycle = %v, want %v, %v", version.typed(), version.supportLifecycle(), fixture.typed, fixture.lifecycle)
+			}
+			for _, dataPath := range []string{"/data", "/data/"} {
+				if path := GetIndicesPath(dataPath, version); path != fixture.indicesPath {
+					t.Errorf("GetIndicesPath(%q) = %q, want %q", dataPath, path, fixture.indicesPath)
+				}
+			}
+
+			indexMap := GetIndiceMap(client, ALL_INDICES)
+			if len(indexMap) != 3 {
+				t.Errorf("got %d indices, want 3: %v", len(indexMap), indexMap)
+			}
+			if index := indexMap["old"]; !index.closed || index.uuid != "pL5tKc8vQw2nY0bR3mXsDa" {
+				t.Errorf("index old = %+v, want closed with its uuid", index)
+			}
+			if index := indexMap["logs-2024.01.01"]; index.closed || index.creationDate != 1704067200123 {
+				t.Errorf("index logs-2024.01.01 = %+v, want open created at 1704067200123", index)
+			}
+
+			shardMap := FillShardMapFilterNode(GetShardMap(client), indexMap, "node-1")
+			if len(shardMap) != len(fixture.localShards) {
+				t.Errorf("got %d shards on node-1, want %d: %v", len(shardMap), len(fixture.localShards), shardMap)
+			}
+			for _, key := range fixture.localShards {
+				if shard, exist := shardMap[key]; !exist || shard.uuid != indexMap[shard.indexName].uuid {
+					t.Errorf("shard %s = %+v, want it with the uuid of its index", key, shard)
+				}
+			}
+
+			node := GetNodeInfo(client, "node-1")
+			if node.Id != "Tq1vNk5mRzKs0bE7hYwP2A" || node.Tier != fixture.tier || node.Pid == 0 {
+				t.Errorf("node = %+v, want tier %q", node, fixture.tier)
+			}
+			if errors := TakeErrorStats(); errors.total() != 0 {
+				t.Errorf("errors = %v, want none", errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"es-pcstat/es-collect"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	ADVISE_FORMAT_CONSOLE = "console"
+	ADVISE_FORMAT_JSON    = "json"
+)
+
+//es-pcstat advise [flags] ./es.conf, classify the indices of this node by residency now and in the history
+//written by the es output, and suggest actions
+func runAdvise(args []string) {
+	flagSet := flag.NewFlagSet("advise", flag.ExitOnError)
+	window := flagSet.Duration("window", 7*24*time.Hour, "history window read from the es output, 0 uses the residency of now only")
+	format := flagSet.String("format", ADVISE_FORMAT_CONSOLE, "output format, choose in [console, json]")
+	hotPercent := flagSet.Float64("hotPercent", es_collect.DEFAULT_ADVISE_OPTIONS.HotPercent, "cached percent from which an index is hot")
+	coldPercent := flagSet.Float64("coldPercent", es_collect.DEFAULT_ADVISE_OPTIONS.ColdPercent, "cached percent up to which an index is cold")
+	maxSegments := flagSet.Int("maxSegmentsPerShard", es_collect.DEFAULT_ADVISE_OPTIONS.MaxSegmentsPerShard,
+		"force-merge is suggested for warm and cold indices with more segments per shard")
+	flagSet.Parse(args)
+	if flagSet.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "usage: es-pcstat advise [flags] ./es.conf")
+		flagSet.PrintDefaults()
+		os.Exit(2)
+	}
+	if *format != ADVISE_FORMAT_CONSOLE && *format != ADVISE_FORMAT_JSON {
+		panic(fmt.Errorf("unknown advise format %q, choose in [console, json]", *format))
+	}
+
+	config := initConfig(flagSet.Arg(0))
+	collector := newCollector(config)
+	indexStats, ok := collector.collect()
+	if !ok {
+		panic(fmt.Errorf("indices path is unknown, set %s or %s", ES_INDICES_PATH_FIELD, ES_DATA_PATH_FIELD))
+	}
+
+	history := map[string]es_collect.CacheHistory{}
+	if *window > 0 {
+		history = getCacheHistory(config, *window)
+	}
+	options := es_collect.AdviseOptions{HotPercent: *hotPercent, ColdPercent: *coldPercent, MaxSegmentsPerShard: *maxSegments}
+	//freeze is suggested only if the collected cluster supports it
+	version, err := es_collect.GetClusterVersion(collector.client)
+	if err != nil {
+		es_collect.Diag.Warnf("advise without freeze, %v", err)
+	}
+	options.Version = version
+	advices := indexStats.Advise(history, options)
+	if *format == ADVISE_FORMAT_JSON {
+		if err := es_collect.FormatAdviceForJson(advices); err != nil {
+			panic(err)
+		}
+		return
+	}
+	es_collect.FormatAdviceForConsole(advices)
+}
+
+//history is optional, without the es output the advice is made from the residency of now
+func getCacheHistory(config map[string]string, window time.Duration) map[string]es_collect.CacheHistory {
+	indexPrefix := config[OUTPUT_ES_PC_INDEX_NAME]
+	if indexPrefix == "" {
+		indexPrefix = es_collect.PCSTAT_INDEX_NAME
+	}
+	esClient, err := es_collect.OutputClient(getOutputEsConfig(config))
+	if err == nil {
+		var history map[string]es_collect.CacheHistory
+		history, err = es_collect.GetCacheHistory(esClient, indexPrefix, config[ES_NODE_NAME_FIELD], window)
+		if err == nil {
+			return history
+		}
+	}
+	es_collect.Diag.Warnf("advise without history, %v", err)
+	return map[string]es_collect.CacheHistory{}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"es-pcstat/es-collect"
+	"fmt"
+)
+
+//collect the stats of one cycle, it is shared by the collect loop and the commands
+type collector struct {
+	config      map[string]string
+	client      es_collect.Client
+	nodeName    string
+	path        string
+	indexFilter *es_collect.IndexFilter
+	grouper     *es_collect.IndexGrouper
+	//es.pid, 0 to use the pid of _nodes
+	pid int
+	//local shards of the last collect, without orphans
+	shardMap es_collect.ShardMap
+}
+
+func newCollector(config map[string]string) *collector {
+	if config[ES_INDICES_PATH_FIELD] == "" && config[ES_DATA_PATH_FIELD] == "" {
+		panic(fmt.Errorf("%s or %s is required", ES_INDICES_PATH_FIELD, ES_DATA_PATH_FIELD))
+	}
+	client := initEsClient(config[ES_SCHEME_FIELD], config[ES_IP_FIELD], config[ES_PORT_FIELD], config[ES_USER], config[ES_PASSWORD])
+	indexFilter := initIndexFilter(config)
+	if config[ES_COLLECTION_HARD_LINK_POLICY] != "" {
+		if err := es_collect.CheckHardLinkPolicy(config[ES_COLLECTION_HARD_LINK_POLICY]); err != nil {
+			panic(err)
+		}
+		es_collect.HARD_LINK_POLICY = config[ES_COLLECTION_HARD_LINK_POLICY]
+	}
+	grouper, err := es_collect.NewIndexGrouper(splitConfigList(config[OUTPUT_GROUP_BY_FIELD]), config[OUTPUT_GROUP_PATTERN_FIELD])
+	if err != nil {
+		panic(err)
+	}
+	return &collector{config: config, client: client, nodeName: config[ES_NODE_NAME_FIELD], path: config[ES_INDICES_PATH_FIELD],
+		indexFilter: indexFilter, grouper: grouper, pid: getEsPid(config)}
+}
+
+//false if the indices path is not known yet
+func (collector *collector) resolvePath() bool {
+	if collector.path == "" {
+		collector.path = getIndicesPath(collector.client, collector.config[ES_DATA_PATH_FIELD])
+	}
+	return collector.path != ""
+}
+
+//false if the indices path is not known yet
+func (collector *collector) collect() (es_collect.IndexStats, bool) {
+	client := collector.client
+	nodeName := collector.nodeName
+	if !collector.resolvePath() {
+		return es_collect.IndexStats{}, false
+	}
+	path := collector.path
+	node := es_collect.GetNodeInfo(client, nodeName)
+	allIndexMap := es_collect.GetIndiceMap(client, es_collect.ALL_INDICES)
+	shardMap := es_collect.GetShardMap(client)
+	orphanShards := es_collect.FindOrphanShards(path, shardMap, allIndexMap, nodeName)
+	indexMap := collector.indexFilter.Filter(allIndexMap)
+	shardMap = es_collect.FillShardMapFilterNode(shardMap, indexMap, nodeName)
+	shardMap = es_collect.FillShardMapSegments(client, shardMap, node.Id)
+	pid := collector.pid
+	if pid == 0 {
+		pid = node.Pid
+	}
+	shardMap = shardMap.FillDeletedFiles(es_collect.GetDeletedFiles(pid))
+	collector.shardMap = shardMap
+	shardMap = shardMap.AddAll(orphanShards)
+	indexStats := shardMap.Stats(path)
+	indexStats = indexStats.WithGroups(collector.grouper.GetIndexGroups(client, indexMap))
+	indexStats = indexStats.WithNode(node)
+	indexStats = indexStats.WithErrors(es_collect.TakeErrorStats())
+	return indexStats, true
+}
+
+//shards of this node of the indices matched by filter, for the commands working on the files
+func (collector *collector) localShards(filter *es_collect.IndexFilter) (es_collect.ShardMap, bool) {
+	client := collector.client
+	if !collector.resolvePath() {
+		return nil, false
+	}
+	indexMap := filter.Filter(es_collect.GetIndiceMap(client, es_collect.ALL_INDICES))
+	return es_collect.FillShardMapFilterNode(es_collect.GetShardMap(client), indexMap, collector.nodeName), true
+}
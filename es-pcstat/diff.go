@@ -0,0 +1,43 @@
+package main
+
+import (
+	"es-pcstat/es-collect"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+//es-pcstat -save ./before.json ./es.conf, the files are saved as they are counted in the collect
+func saveCollectionSnapshot(collector *collector, path string) {
+	es_collect.KEEP_FILE_STATS = true
+	collectStart := time.Now()
+	indexStats, ok := collector.collect()
+	if !ok {
+		panic(fmt.Errorf("indices path is unknown, set %s or %s", ES_INDICES_PATH_FIELD, ES_DATA_PATH_FIELD))
+	}
+	snapshot := indexStats.GetCollectionSnapshot(collector.config[ES_CLUSTER_NAME], collector.nodeName, collectStart)
+	if err := es_collect.SaveCollectionSnapshot(path, snapshot); err != nil {
+		panic(err)
+	}
+	es_collect.Diag.Infof("saved snapshot of %d shards to %q", len(snapshot.Shards), path)
+}
+
+//es-pcstat diff a.json b.json, compare two snapshots saved by -save offline
+func runDiff(args []string) {
+	flagSet := flag.NewFlagSet("diff", flag.ExitOnError)
+	flagSet.Parse(args)
+	if flagSet.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: es-pcstat diff before.json after.json")
+		os.Exit(2)
+	}
+	before, err := es_collect.LoadCollectionSnapshot(flagSet.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	after, err := es_collect.LoadCollectionSnapshot(flagSet.Arg(1))
+	if err != nil {
+		panic(err)
+	}
+	es_collect.FormatDiffForConsole(before, after, es_collect.DiffSnapshots(before, after))
+}
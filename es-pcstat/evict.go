@@ -0,0 +1,29 @@
+package main
+
+import (
+	"es-pcstat"
+	"es-pcstat/es-collect"
+	"flag"
+	"fmt"
+	"os"
+)
+
+//es-pcstat evict [flags] ./es.conf index..., drop the pages of the shard files of the indices on this node from the page cache,
+//the rest of the page cache of the host is kept unlike drop_caches
+func runEvict(args []string) {
+	flagSet := flag.NewFlagSet("evict", flag.ExitOnError)
+	shards := flagSet.String("shards", "", "shard ids to evict separated by comma like 0,2, empty for all shards")
+	suffixes := flagSet.String("suffixes", "", "file suffixes to evict separated by comma like tim,doc,dvd, empty for all files")
+	flagSet.Parse(args)
+	if flagSet.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "usage: es-pcstat evict [flags] ./es.conf index...")
+		fmt.Fprintln(os.Stderr, "index is a name, a glob like logs-2021.* or a regex like re:^logs-.*$")
+		flagSet.PrintDefaults()
+		os.Exit(2)
+	}
+
+	files := getShardFiles(flagSet.Arg(0), flagSet.Args()[1:], splitConfigList(*shards), splitConfigList(*suffixes))
+	if err := es_collect.AdviseFiles("evict", files, es_pcstat.FADV_DONTNEED, 0, 0); err != nil {
+		panic(err)
+	}
+}
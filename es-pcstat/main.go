@@ -33,22 +33,36 @@ import (
 	"strings"
 	"time"
 
-	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/olivere/elastic.v6"
 )
 
 var (
 	collectIntervalFlag int
 	outputTypeFlag      string
 	sortFlag            bool
+	columnsFlag         string
+	logLevelFlag        string
+	saveFlag            string
 )
 
+//commands run once instead of the collect loop, like es-pcstat advise ./es.conf
+var commands = map[string]func(args []string){
+	"advise":  runAdvise,
+	"diff":    runDiff,
+	"evict":   runEvict,
+	"prewarm": runPrewarm,
+	"restore": runRestore,
+}
+
 func init() {
 	// TODO: error on useless/broken combinations
 	flag.IntVar(&collectIntervalFlag, "collectIntervalFlag", 60, "the interval between collect")
-	flag.StringVar(&outputTypeFlag, "outputTypeFlag", "console", "output ,choose in [es, log, console]")
+	flag.StringVar(&outputTypeFlag, "outputTypeFlag", "console", "output ,choose in [es, log, console, csv, jsonl, influx, graphite, otlp], separated by comma for more than one")
 	flag.BoolVar(&sortFlag, "sortFlag", false, "sort by cache desc")
+	flag.StringVar(&columnsFlag, "columnsFlag", strings.Join(es_collect.DEFAULT_CONSOLE_COLUMNS, ","),
+		"console columns, choose in [cache, pri, rep, size, percent, shards, delta, relocating, initializing, docs, store, segments, cache_per_gb, cache_per_mdocs, merged, unsearchable, committed, new, shared] or any file suffix like tim,doc,dvd,deleted")
+	flag.StringVar(&logLevelFlag, "logLevelFlag", "info", "level of the diagnostic log on stderr, choose in [debug, info, warn, error]")
+	flag.StringVar(&saveFlag, "save", "", "collect once and save a snapshot of every shard file to the file instead of the outputs, compared by es-pcstat diff")
 
 }
 
@@ -56,12 +70,29 @@ const (
 	ES_IP_FIELD           = "es.ip"
 	ES_PORT_FIELD         = "es.port"
 	ES_INDICES_PATH_FIELD = "es.indicesPath"
+	ES_DATA_PATH_FIELD    = "es.dataPath"
+	ES_SCHEME_FIELD       = "es.scheme"
 	ES_NODE_NAME_FIELD    = "es.nodeName"
+	ES_PID_FIELD          = "es.pid"
 	ES_CLUSTER_NAME       = "es.clusterName"
 	ES_USER               = "es.user"
 	ES_PASSWORD           = "es.password"
 
 	ES_COLLECTION_INDICES_PREFIX_FIELD = "es.collection.indicesPrefix"
+	ES_COLLECTION_INCLUDE_FIELD        = "es.collection.include"
+	ES_COLLECTION_EXCLUDE_FIELD        = "es.collection.exclude"
+	ES_COLLECTION_SKIP_SYSTEM_FIELD    = "es.collection.skipSystem"
+	ES_COLLECTION_SKIP_CLOSED_FIELD    = "es.collection.skipClosed"
+	ES_COLLECTION_COLLECT_OWN_FIELD    = "es.collection.collectOwnIndices"
+	ES_COLLECTION_HARD_LINK_POLICY     = "es.collection.hardLinkPolicy"
+
+	ES_RESIDENCY_SNAPSHOT_PATH_FIELD     = "es.residency.snapshotPath"
+	ES_RESIDENCY_SNAPSHOT_INTERVAL_FIELD = "es.residency.snapshotInterval"
+
+	OUTPUT_TYPES_FIELD = "output.types"
+
+	OUTPUT_GROUP_BY_FIELD      = "output.groupBy"
+	OUTPUT_GROUP_PATTERN_FIELD = "output.groupPattern"
 
 	OUTPUT_LOG_KEEP_LOG_NUM_FIELD = "output.log.keepLogNum"
 	OUTPUT_LOG_LOG_PATH_FIELD     = "output.log.logPath"
@@ -72,92 +103,103 @@ const (
 	OUTPUT_ES_PASSWORD             = "output.es.password"
 	OUTPUT_ES_IP_FIELD             = "output.es.ip"
 	OUTPUT_ES_PORT_FIELD           = "output.es.port"
-)
+	OUTPUT_ES_SCHEME_FIELD         = "output.es.scheme"
+	OUTPUT_ES_MODE_FIELD           = "output.es.mode"
 
-// init log
-func initLog(path string, keepLogNum int) {
-	/* 日志轮转相关函数
-	`WithLinkName` 为最新的日志建立软连接
-	`WithRotationTime` 设置日志分割的时间，隔多久分割一次
-	WithMaxAge 和 WithRotationCount二者只能设置一个
-	 `WithMaxAge` 设置文件清理前的最长保存时间
-	 `WithRotationCount` 设置文件清理前最多保存的个数
-	*/
-	if outputTypeFlag == LOG {
-		writer, _ := rotatelogs.New(
-			path+".%Y%m%d",
-			rotatelogs.WithLinkName(path),
-			rotatelogs.WithMaxAge(time.Duration(24*keepLogNum)*time.Hour),
-			rotatelogs.WithRotationTime(time.Duration(24)*time.Hour),
-		)
-		log.SetOutput(writer)
-		log.SetFormatter(&log.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05"})
-	}
-}
+	OUTPUT_ES_SPOOL_PATH_FIELD        = "output.es.spoolPath"
+	OUTPUT_ES_SPOOL_MAX_BATCHES_FIELD = "output.es.spoolMaxBatches"
+
+	OUTPUT_INFLUX_URL_FIELD         = "output.influx.url"
+	OUTPUT_INFLUX_USER              = "output.influx.user"
+	OUTPUT_INFLUX_PASSWORD          = "output.influx.password"
+	OUTPUT_INFLUX_MEASUREMENT_FIELD = "output.influx.measurement"
+
+	OUTPUT_GRAPHITE_ADDRESS_FIELD       = "output.graphite.address"
+	OUTPUT_GRAPHITE_PATH_TEMPLATE_FIELD = "output.graphite.pathTemplate"
+
+	OUTPUT_OTLP_ENDPOINT_FIELD = "output.otlp.endpoint"
+	OUTPUT_OTLP_PROTOCOL_FIELD = "output.otlp.protocol"
+	OUTPUT_OTLP_HEADERS_FIELD  = "output.otlp.headers"
+)
 
 func main() {
 	flag.Parse()
-	files := flag.Args()
-	config := initConfig(files[0])
-	//	fmt.Printf("user,%s;password,%s", config[ES_USER], config[ES_PASSWORD])
-	client := initEsClient(config[ES_IP_FIELD], config[ES_PORT_FIELD], config[ES_USER], config[ES_PASSWORD])
-	nodeName := config[ES_NODE_NAME_FIELD]
-	path := config[ES_INDICES_PATH_FIELD]
-	clusterName := config[ES_CLUSTER_NAME]
-	indicesPrefix := strings.Split(config[ES_COLLECTION_INDICES_PREFIX_FIELD], ",")
-	if outputTypeFlag == LOG {
-		logPath := config[OUTPUT_LOG_LOG_PATH_FIELD]
-		keepLogNum, err := strconv.Atoi(config[OUTPUT_LOG_KEEP_LOG_NUM_FIELD])
-		if err != nil {
-			fmt.Printf("keepLogNum can't conv to integer,%s", err)
-			keepLogNum = 5
-		}
-		initLog(logPath, keepLogNum)
+	if err := es_collect.SetDiagLevel(logLevelFlag); err != nil {
+		panic(err)
 	}
-	if outputTypeFlag == ES {
-		keepIndexNum, err := strconv.Atoi(config[OUTPUT_ES_KEEP_INDEX_NUM_FIELD])
-		if err != nil {
-			fmt.Printf("keepIndexNum can't conv to integer,%s", err)
-			keepIndexNum = 5
+	args := flag.Args()
+	if len(args) > 0 {
+		if command, exist := commands[args[0]]; exist {
+			command(args[1:])
+			return
 		}
-		es_collect.KEEP_INDEX_NUM = keepIndexNum
-		es_collect.PCSTAT_INDEX_NAME = config[OUTPUT_ES_PC_INDEX_NAME]
 	}
+	config := initConfig(args[0])
+	nodeName := config[ES_NODE_NAME_FIELD]
+	clusterName := config[ES_CLUSTER_NAME]
+	collector := newCollector(config)
+	if saveFlag != "" {
+		saveCollectionSnapshot(collector, saveFlag)
+		return
+	}
+	outputTypes := getOutputTypes(config)
+	sinks := es_collect.StartSinks(initSinks(outputTypes, config))
+	saver := newSnapshotSaver(config)
 
 	for {
 		collectStart := time.Now()
-		fmt.Printf("start collect time, %s\n", collectStart)
-		indexMap := es_collect.GetIndiceMap(client, indicesPrefix)
-		shardMap := es_collect.GetShardMap(client)
-		shardMap = es_collect.FillShardMapFilterNode(shardMap, indexMap, nodeName)
-		indexStats := shardMap.Stats(path)
-
-		if outputTypeFlag == ES {
-			var outputclient elastic.Client
-			if config[OUTPUT_ES_USER] == "" || config[OUTPUT_ES_PASSWORD] == "" || config[OUTPUT_ES_IP_FIELD] == "" || config[OUTPUT_ES_PORT_FIELD] == "" {
-				outputclient = es_collect.OutputClient(config[ES_IP_FIELD], config[ES_PORT_FIELD], config[ES_USER], config[ES_PASSWORD])
-			} else {
-				outputclient = es_collect.OutputClient(config[OUTPUT_ES_IP_FIELD], config[OUTPUT_ES_PORT_FIELD], config[OUTPUT_ES_USER], config[OUTPUT_ES_PASSWORD])
-			}
-			indexStats.WriteToEs(outputclient, clusterName, nodeName, collectStart)
-		} else if outputTypeFlag == LOG {
-			indexStats.FormatForSLS(clusterName, nodeName, collectStart)
-		} else if outputTypeFlag == CONSOLE {
-			indexStats.FormatForConsole(sortFlag)
+		es_collect.Diag.Infof("start collect time, %s", collectStart)
+		indexStats, ok := collector.collect()
+		if !ok {
+			waitToNextCollect(collectStart, collectIntervalFlag)
+			continue
 		}
 
+		sinks.Write(indexStats, clusterName, nodeName, collectStart)
+		saver.save(collector, collectStart)
+
 		waitToNextCollect(collectStart, collectIntervalFlag)
 	}
 }
 
+//indicesPrefix are kept as includes of prefix*
+func initIndexFilter(config map[string]string) *es_collect.IndexFilter {
+	include := es_collect.PrefixPatterns(strings.Split(config[ES_COLLECTION_INDICES_PREFIX_FIELD], ","))
+	include = append(include, splitConfigList(config[ES_COLLECTION_INCLUDE_FIELD])...)
+	ownIndexName := config[OUTPUT_ES_PC_INDEX_NAME]
+	if ownIndexName == "" {
+		ownIndexName = es_collect.PCSTAT_INDEX_NAME
+	}
+	indexFilter, err := es_collect.NewIndexFilter(include, splitConfigList(config[ES_COLLECTION_EXCLUDE_FIELD]),
+		config[ES_COLLECTION_SKIP_SYSTEM_FIELD] == "true", config[ES_COLLECTION_SKIP_CLOSED_FIELD] == "true",
+		ownIndexName, config[ES_COLLECTION_COLLECT_OWN_FIELD] == "true")
+	if err != nil {
+		panic(err)
+	}
+	return indexFilter
+}
+
+//es.pid wins over the pid from _nodes, which is wrong if es runs in another pid namespace like a container
+//pid of es.pid, 0 if it is not set and the pid of _nodes is used
+func getEsPid(config map[string]string) int {
+	if config[ES_PID_FIELD] == "" {
+		return 0
+	}
+	pid, err := strconv.Atoi(config[ES_PID_FIELD])
+	if err != nil || pid <= 0 {
+		panic(fmt.Errorf("%s must be a positive number, got %q", ES_PID_FIELD, config[ES_PID_FIELD]))
+	}
+	return pid
+}
+
 func waitToNextCollect(collectStart time.Time, collectIntervalFlag int) {
 	nextTime := collectStart.Add(time.Duration(collectIntervalFlag) * time.Second)
 	for {
 		if nextTime.After(time.Now()) {
 			duration := nextTime.Sub(time.Now())
-			fmt.Printf("currnet time to sleep, %s\n", time.Now())
-			fmt.Printf("wait for next collect, sleep %s seconds\n", duration)
-			fmt.Printf("next time collect time, %s\n", nextTime)
+			es_collect.Diag.Debugf("currnet time to sleep, %s", time.Now())
+			es_collect.Diag.Infof("wait for next collect, sleep %s seconds", duration)
+			es_collect.Diag.Debugf("next time collect time, %s", nextTime)
 			time.Sleep(duration)
 			break
 		} else {
@@ -166,11 +208,23 @@ func waitToNextCollect(collectStart time.Time, collectIntervalFlag int) {
 	}
 }
 
-func initEsClient(ip string, port string, user string, password string) es_collect.Client {
-	client := es_collect.CollectClient(ip, port, user, password)
+func initEsClient(scheme string, ip string, port string, user string, password string) es_collect.Client {
+	client := es_collect.CollectClient(scheme, ip, port, user, password)
 	return *client
 }
 
+//derive indices path from es.dataPath by the version of the collected cluster, "" when the version is unknown
+func getIndicesPath(client es_collect.Client, dataPath string) string {
+	version, err := es_collect.GetClusterVersion(client)
+	if err != nil {
+		es_collect.Diag.Errorf("%v", err)
+		return ""
+	}
+	path := es_collect.GetIndicesPath(dataPath, version)
+	es_collect.Diag.Infof("collect cluster version, %s, indices path, %s", version, path)
+	return path
+}
+
 func initConfig(path string) map[string]string {
 	config := make(map[string]string)
 
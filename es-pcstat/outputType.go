@@ -1,7 +1,148 @@
 package main
 
+import (
+	"es-pcstat/es-collect"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 const (
-	ES      string = "es"
-	LOG     string = "log"
-	CONSOLE string = "console"
+	ES       string = "es"
+	LOG      string = "log"
+	CONSOLE  string = "console"
+	CSV      string = "csv"
+	JSONL    string = "jsonl"
+	INFLUX   string = "influx"
+	GRAPHITE string = "graphite"
+	OTLP     string = "otlp"
 )
+
+//outputTypeFlag wins over output.types in config when it is set on command line
+func getOutputTypes(config map[string]string) []string {
+	outputTypes := outputTypeFlag
+	flagSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "outputTypeFlag" {
+			flagSet = true
+		}
+	})
+	if !flagSet && config[OUTPUT_TYPES_FIELD] != "" {
+		outputTypes = config[OUTPUT_TYPES_FIELD]
+	}
+	return splitConfigList(outputTypes)
+}
+
+//split comma separated config and skip blank items
+func splitConfigList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+//split k1=v1,k2=v2 config
+func splitConfigMap(value string) map[string]string {
+	items := map[string]string{}
+	for _, item := range splitConfigList(value) {
+		index := strings.Index(item, "=")
+		if index <= 0 {
+			continue
+		}
+		items[strings.TrimSpace(item[:index])] = strings.TrimSpace(item[index+1:])
+	}
+	return items
+}
+
+//es output writes to the collected cluster unless output.es.* is all set
+func getOutputEsConfig(config map[string]string) (string, string, string, string, string) {
+	if config[OUTPUT_ES_USER] == "" || config[OUTPUT_ES_PASSWORD] == "" || config[OUTPUT_ES_IP_FIELD] == "" || config[OUTPUT_ES_PORT_FIELD] == "" {
+		return config[ES_SCHEME_FIELD], config[ES_IP_FIELD], config[ES_PORT_FIELD], config[ES_USER], config[ES_PASSWORD]
+	}
+	return config[OUTPUT_ES_SCHEME_FIELD], config[OUTPUT_ES_IP_FIELD], config[OUTPUT_ES_PORT_FIELD], config[OUTPUT_ES_USER], config[OUTPUT_ES_PASSWORD]
+}
+
+func initSinks(outputTypes []string, config map[string]string) []es_collect.Sink {
+	sinks := make([]es_collect.Sink, 0, len(outputTypes))
+	for _, outputType := range outputTypes {
+		switch outputType {
+		case ES:
+			keepIndexNum, err := strconv.Atoi(config[OUTPUT_ES_KEEP_INDEX_NUM_FIELD])
+			if err != nil {
+				es_collect.Diag.Warnf("keepIndexNum can't conv to integer,%s", err)
+				keepIndexNum = 5
+			}
+			es_collect.KEEP_INDEX_NUM = keepIndexNum
+			if config[OUTPUT_ES_PC_INDEX_NAME] != "" {
+				es_collect.PCSTAT_INDEX_NAME = config[OUTPUT_ES_PC_INDEX_NAME]
+			}
+			var spool *es_collect.Spool
+			if config[OUTPUT_ES_SPOOL_PATH_FIELD] != "" {
+				spoolMaxBatches, err := strconv.Atoi(config[OUTPUT_ES_SPOOL_MAX_BATCHES_FIELD])
+				if err != nil {
+					spoolMaxBatches = 1000
+				}
+				spool, err = es_collect.NewSpool(config[OUTPUT_ES_SPOOL_PATH_FIELD], spoolMaxBatches)
+				if err != nil {
+					panic(err)
+				}
+			}
+			scheme, ip, port, user, password := getOutputEsConfig(config)
+			sink, err := es_collect.NewEsSink(scheme, ip, port, user, password, config[OUTPUT_ES_MODE_FIELD], spool)
+			if err != nil {
+				panic(err)
+			}
+			sinks = append(sinks, sink)
+		case LOG:
+			logPath := config[OUTPUT_LOG_LOG_PATH_FIELD]
+			if logPath == "" {
+				logPath = "/tmp/pcstat.log"
+			}
+			keepLogNum, err := strconv.Atoi(config[OUTPUT_LOG_KEEP_LOG_NUM_FIELD])
+			if err != nil {
+				es_collect.Diag.Warnf("keepLogNum can't conv to integer,%s", err)
+				keepLogNum = 5
+			}
+			sink, err := es_collect.NewLogSink(logPath, keepLogNum)
+			if err != nil {
+				panic(err)
+			}
+			sinks = append(sinks, sink)
+		case CONSOLE:
+			sinks = append(sinks, es_collect.NewConsoleSink(sortFlag, strings.Split(columnsFlag, ",")))
+		case CSV:
+			sinks = append(sinks, es_collect.CsvSink{})
+		case JSONL:
+			sinks = append(sinks, es_collect.JsonLinesSink{})
+		case INFLUX:
+			if config[OUTPUT_INFLUX_URL_FIELD] == "" {
+				panic(fmt.Errorf("%s is required for influx output", OUTPUT_INFLUX_URL_FIELD))
+			}
+			sinks = append(sinks, es_collect.NewInfluxSink(config[OUTPUT_INFLUX_URL_FIELD], config[OUTPUT_INFLUX_USER],
+				config[OUTPUT_INFLUX_PASSWORD], config[OUTPUT_INFLUX_MEASUREMENT_FIELD]))
+		case GRAPHITE:
+			if config[OUTPUT_GRAPHITE_ADDRESS_FIELD] == "" {
+				panic(fmt.Errorf("%s is required for graphite output", OUTPUT_GRAPHITE_ADDRESS_FIELD))
+			}
+			sinks = append(sinks, es_collect.NewGraphiteSink(config[OUTPUT_GRAPHITE_ADDRESS_FIELD], config[OUTPUT_GRAPHITE_PATH_TEMPLATE_FIELD]))
+		case OTLP:
+			if config[OUTPUT_OTLP_ENDPOINT_FIELD] == "" {
+				panic(fmt.Errorf("%s is required for otlp output", OUTPUT_OTLP_ENDPOINT_FIELD))
+			}
+			sink, err := es_collect.NewOtlpSink(config[OUTPUT_OTLP_ENDPOINT_FIELD], config[OUTPUT_OTLP_PROTOCOL_FIELD],
+				splitConfigMap(config[OUTPUT_OTLP_HEADERS_FIELD]))
+			if err != nil {
+				panic(err)
+			}
+			sinks = append(sinks, sink)
+		default:
+			panic(fmt.Errorf("unknown output type %q", outputType))
+		}
+	}
+	return sinks
+}
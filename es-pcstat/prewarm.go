@@ -0,0 +1,45 @@
+package main
+
+import (
+	"es-pcstat"
+	"es-pcstat/es-collect"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+//es-pcstat prewarm [flags] ./es.conf index..., read the shard files of the indices on this node into the page cache
+func runPrewarm(args []string) {
+	flagSet := flag.NewFlagSet("prewarm", flag.ExitOnError)
+	suffixes := flagSet.String("suffixes", "", "file suffixes to prewarm separated by comma like tim,doc,dvd, empty for all files")
+	rate := flagSet.Int("rate", 0, "io rate limit in MB per second, 0 is unlimited")
+	progressInterval := flagSet.Duration("progressInterval", 5*time.Second, "interval of the progress with the residency from mincore")
+	flagSet.Parse(args)
+	if flagSet.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "usage: es-pcstat prewarm [flags] ./es.conf index...")
+		fmt.Fprintln(os.Stderr, "index is a name, a glob like logs-2021.* or a regex like re:^logs-.*$")
+		flagSet.PrintDefaults()
+		os.Exit(2)
+	}
+
+	files := getShardFiles(flagSet.Arg(0), flagSet.Args()[1:], nil, splitConfigList(*suffixes))
+	if err := es_collect.AdviseFiles("prewarm", files, es_pcstat.FADV_WILLNEED, *rate, *progressInterval); err != nil {
+		panic(err)
+	}
+}
+
+//files on this node of the shards of the indices matched by patterns, all shards if shardIds is empty
+func getShardFiles(configPath string, patterns []string, shardIds []string, suffixes []string) []string {
+	config := initConfig(configPath)
+	filter, err := es_collect.NewIndexFilter(patterns, nil, false, false, "", true)
+	if err != nil {
+		panic(err)
+	}
+	collector := newCollector(config)
+	shardMap, ok := collector.localShards(filter)
+	if !ok {
+		panic(fmt.Errorf("indices path is unknown, set %s or %s", ES_INDICES_PATH_FIELD, ES_DATA_PATH_FIELD))
+	}
+	return shardMap.FilterShardIds(shardIds).GetShardFiles(collector.path, suffixes)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"es-pcstat/es-collect"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+//seconds between two residency snapshots
+const DEFAULT_SNAPSHOT_INTERVAL = 600
+
+//save the residency of the collected shards every interval, restored by es-pcstat restore after a restart
+type snapshotSaver struct {
+	path     string
+	interval time.Duration
+	lastSave time.Time
+}
+
+func newSnapshotSaver(config map[string]string) *snapshotSaver {
+	interval := DEFAULT_SNAPSHOT_INTERVAL
+	if config[ES_RESIDENCY_SNAPSHOT_INTERVAL_FIELD] != "" {
+		var err error
+		interval, err = strconv.Atoi(config[ES_RESIDENCY_SNAPSHOT_INTERVAL_FIELD])
+		if err != nil {
+			panic(fmt.Errorf("%s must be seconds, %v", ES_RESIDENCY_SNAPSHOT_INTERVAL_FIELD, err))
+		}
+	}
+	return &snapshotSaver{path: config[ES_RESIDENCY_SNAPSHOT_PATH_FIELD], interval: time.Duration(interval) * time.Second}
+}
+
+func (saver *snapshotSaver) save(collector *collector, collectStart time.Time) {
+	if saver.path == "" || collectStart.Sub(saver.lastSave) < saver.interval {
+		return
+	}
+	snapshot := collector.shardMap.GetResidencySnapshot(collector.path, collector.nodeName)
+	if err := es_collect.SaveResidencySnapshot(saver.path, snapshot); err != nil {
+		es_collect.Diag.Errorf("save residency snapshot %q error, %v", saver.path, err)
+		return
+	}
+	saver.lastSave = collectStart
+	es_collect.Diag.Infof("saved residency snapshot of %d files to %q", len(snapshot.Files), saver.path)
+}
+
+//es-pcstat restore [flags] ./es.conf, read the pages cached at the last snapshot into the page cache again
+func runRestore(args []string) {
+	flagSet := flag.NewFlagSet("restore", flag.ExitOnError)
+	snapshotPath := flagSet.String("snapshot", "", "residency snapshot to restore, "+ES_RESIDENCY_SNAPSHOT_PATH_FIELD+" of the conf if empty")
+	rate := flagSet.Int("rate", 0, "io rate limit in MB per second, 0 is unlimited")
+	progressInterval := flagSet.Duration("progressInterval", 5*time.Second, "interval of the progress with the residency from mincore")
+	flagSet.Parse(args)
+	if flagSet.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "usage: es-pcstat restore [flags] ./es.conf")
+		flagSet.PrintDefaults()
+		os.Exit(2)
+	}
+
+	config := initConfig(flagSet.Arg(0))
+	if *snapshotPath == "" {
+		*snapshotPath = config[ES_RESIDENCY_SNAPSHOT_PATH_FIELD]
+	}
+	if *snapshotPath == "" {
+		panic(fmt.Errorf("snapshot is unknown, set -snapshot or %s", ES_RESIDENCY_SNAPSHOT_PATH_FIELD))
+	}
+	snapshot, err := es_collect.LoadResidencySnapshot(*snapshotPath)
+	if err != nil {
+		panic(err)
+	}
+	collector := newCollector(config)
+	if !collector.resolvePath() {
+		panic(fmt.Errorf("indices path is unknown, set %s or %s", ES_INDICES_PATH_FIELD, ES_DATA_PATH_FIELD))
+	}
+	if err := es_collect.RestoreResidency(collector.path, snapshot, *rate, *progressInterval); err != nil {
+		panic(err)
+	}
+}
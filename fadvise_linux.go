@@ -0,0 +1,17 @@
+package es_pcstat
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	FADV_WILLNEED = unix.FADV_WILLNEED
+	FADV_DONTNEED = unix.FADV_DONTNEED
+)
+
+// posix_fadvise on a range of the file, length 0 means to the end of the file
+func FileAdvise(f *os.File, offset int64, length int64, advice int) error {
+	return unix.Fadvise(int(f.Fd()), offset, length, advice)
+}
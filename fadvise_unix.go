@@ -0,0 +1,17 @@
+// +build darwin dragonfly freebsd netbsd openbsd solaris
+
+package es_pcstat
+
+import (
+	"errors"
+	"os"
+)
+
+const (
+	FADV_WILLNEED = 3
+	FADV_DONTNEED = 4
+)
+
+func FileAdvise(f *os.File, offset int64, length int64, advice int) error {
+	return errors.New("posix_fadvise is only supported on linux")
+}
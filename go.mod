@@ -1,18 +1,31 @@
 module es-pcstat
 
-go 1.13
+go 1.19
 
 require (
 	github.com/deckarep/golang-set v1.7.1
-	github.com/jonboulle/clockwork v0.2.2 // indirect
 	github.com/lestrrat-go/file-rotatelogs v2.4.0+incompatible
+	github.com/sirupsen/logrus v1.8.1
+	go.opentelemetry.io/proto/otlp v1.0.0
+	golang.org/x/sys v0.10.0
+	google.golang.org/grpc v1.58.3
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/olivere/elastic.v6 v6.2.35
+)
+
+require (
+	github.com/fortytw2/leaktest v1.3.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.16.0 // indirect
+	github.com/jonboulle/clockwork v0.2.2 // indirect
+	github.com/josharian/intern v1.0.0 // indirect
 	github.com/lestrrat-go/strftime v1.0.4 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/olivere/elastic v6.2.35+incompatible // indirect
-	github.com/olivere/elastic/v6 v6.2.1
-	github.com/olivere/elastic/v7 v7.0.24
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/sirupsen/logrus v1.8.1
-	golang.org/x/sys v0.0.0-20210608053332-aa57babbf139
-	gopkg.in/olivere/elastic.v6 v6.2.35
+	github.com/stretchr/testify v1.6.1 // indirect
+	golang.org/x/net v0.12.0 // indirect
+	golang.org/x/text v0.11.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20230711160842-782d3b101e98 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230711160842-782d3b101e98 // indirect
 )
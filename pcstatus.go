@@ -19,8 +19,8 @@ package es_pcstat
 import (
 	"errors"
 	"fmt"
-	"log"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -39,18 +39,23 @@ type PcStatus struct {
 	PPStat    []bool    `json:"status"`    // per-page status, true if cached, false otherwise
 }
 
-func GetPcStatusFiles(files []string) []PcStatus {
+// files that fail are skipped, the returned error lists them
+func GetPcStatusFiles(files []string) ([]PcStatus, error) {
 	stats := make([]PcStatus, 0, len(files))
+	skipped := make([]string, 0)
 	for _, fname := range files {
 		status, err := GetPcStatus(fname)
 		if err != nil {
-			log.Printf("skipping %q: %v", fname, err)
+			skipped = append(skipped, fmt.Sprintf("%q: %v", fname, err))
 			continue
 		}
 
 		stats = append(stats, status)
 	}
-	return stats
+	if len(skipped) > 0 {
+		return stats, fmt.Errorf("skipped %d files, %s", len(skipped), strings.Join(skipped, "; "))
+	}
+	return stats, nil
 }
 
 func GetPcStatus(fname string) (PcStatus, error) {